@@ -3,6 +3,8 @@ package godm
 import (
 	"context"
 
+	"github.com/md-salehzadeh/godm/middleware"
+	"github.com/md-salehzadeh/godm/operator"
 	opts "github.com/md-salehzadeh/godm/options"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -19,67 +21,98 @@ type Aggregate struct {
 	pipeline   interface{}
 	collection *mongo.Collection
 	options    []opts.AggregateOptions
+	middleware *middleware.Chain
 }
 
 // All iterates the cursor from aggregate and decodes each document into results.
 func (a *Aggregate) All(results interface{}) error {
-	opts := options.Aggregate()
-
-	if len(a.options) > 0 {
-		opts = a.options[0].AggregateOptions
-	}
-
-	c, err := a.collection.Aggregate(a.ctx, a.pipeline, opts)
-
-	if err != nil {
-		return err
-	}
+	return a.do(func(ctx context.Context, c *mongo.Cursor) (interface{}, error) {
+		if err := c.All(ctx, results); err != nil {
+			return nil, err
+		}
 
-	return c.All(a.ctx, results)
+		return results, nil
+	})
 }
 
 // One iterates the cursor from aggregate and decodes current document into result.
 func (a *Aggregate) One(result interface{}) error {
-	opts := options.Aggregate()
+	return a.do(func(ctx context.Context, c *mongo.Cursor) (interface{}, error) {
+		cr := Cursor{
+			ctx:    ctx,
+			cursor: c,
+		}
 
-	if len(a.options) > 0 {
-		opts = a.options[0].AggregateOptions
-	}
+		defer cr.Close()
 
-	c, err := a.collection.Aggregate(a.ctx, a.pipeline, opts)
+		if !cr.Next(result) {
+			return nil, ErrNoSuchDocuments
+		}
 
-	if err != nil {
-		return err
-	}
+		return result, nil
+	})
+}
 
-	cr := Cursor{
-		ctx:    a.ctx,
-		cursor: c,
-		err:    err,
-	}
+// Iter return the cursor after aggregate
+func (a *Aggregate) Iter() CursorI {
+	var cursor CursorI
+
+	err := a.do(func(ctx context.Context, c *mongo.Cursor) (interface{}, error) {
+		cursor = &Cursor{
+			ctx:    ctx,
+			cursor: c,
+		}
 
-	defer cr.Close()
+		return cursor, nil
+	})
 
-	if !cr.Next(result) {
-		return ErrNoSuchDocuments
+	if err != nil {
+		// a middleware failed after the cursor was opened
+		if cursor != nil {
+			cursor.Close()
+		}
+
+		return &Cursor{
+			ctx: a.ctx,
+			err: err,
+		}
 	}
 
-	return err
+	return cursor
 }
 
-// Iter return the cursor after aggregate
-func (a *Aggregate) Iter() CursorI {
+// do runs the aggregate command through the middleware chain of the collection
+// read consumes the cursor and returns the result of the operation
+func (a *Aggregate) do(read func(ctx context.Context, c *mongo.Cursor) (interface{}, error)) error {
 	opts := options.Aggregate()
 
 	if len(a.options) > 0 {
 		opts = a.options[0].AggregateOptions
 	}
 
-	c, err := a.collection.Aggregate(a.ctx, a.pipeline, opts)
+	ctx := a.ctx
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
 
-	return &Cursor{
-		ctx:    a.ctx,
-		cursor: c,
-		err:    err,
+	op := &middleware.Operation{
+		Database:   a.collection.Database().Name(),
+		Collection: a.collection.Name(),
+		Type:       operator.OpAggregate,
+		Pipeline:   a.pipeline,
+		Options:    opts,
 	}
+
+	return a.middleware.Run(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		c, err := a.collection.Aggregate(ctx, op.Pipeline, opts)
+
+		if err != nil {
+			return err
+		}
+
+		op.Result, err = read(ctx, c)
+
+		return err
+	})
 }
@@ -2,7 +2,16 @@ package godm
 
 import (
 	"context"
-
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/md-salehzadeh/godm/hook"
+	"github.com/md-salehzadeh/godm/middleware"
+	"github.com/md-salehzadeh/godm/operator"
+	gOpts "github.com/md-salehzadeh/godm/options"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -29,6 +38,125 @@ type BulkResult struct {
 	UpsertedIDs map[int64]interface{}
 }
 
+// BulkOperationError reports the queued operation of a Bulk which failed
+type BulkOperationError struct {
+	// The index of the operation in the queue of the Bulk.
+	Index int
+
+	// The error of the operation.
+	Err error
+}
+
+// Error implements the error interface
+func (e *BulkOperationError) Error() string {
+	return fmt.Sprintf("bulk operation %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the error of the operation
+func (e *BulkOperationError) Unwrap() error {
+	return e.Err
+}
+
+// define the kinds of the failures of the operations of a bulk write
+const (
+	BulkErrorDuplicateKey  = "duplicateKey"
+	BulkErrorValidation    = "validation"
+	BulkErrorWriteConflict = "writeConflict"
+	BulkErrorOther         = "other"
+)
+
+// BulkWriteError is the failure of one queued operation of a Bulk on the server
+type BulkWriteError struct {
+	// The index of the operation in the queue of the Bulk.
+	Index int
+
+	// The code and the message of the error of the server.
+	Code    int
+	Message string
+
+	// The kind of the error, BulkErrorDuplicateKey, BulkErrorValidation, BulkErrorWriteConflict or BulkErrorOther.
+	Kind string
+
+	// The queued write model.
+	Model mongo.WriteModel
+
+	// The operation the middlewares and hooks ran on, nil for the writes godm queues itself, like the hashes of
+	// SyncDocuments.
+	Operation *middleware.Operation
+}
+
+// BulkError is returned by Bulk.Run if a bulk write fails, along with the partial *BulkResult
+// It lists the operations the server rejected, ordered by index. The operations of the chunks an ordered bulk did
+// not write after a failure, and of chunks failing for another reason, like a network error, are not listed
+type BulkError struct {
+	// The failed operations.
+	Errors []BulkWriteError
+
+	// The write concern errors of the chunks.
+	WriteConcernErrors []*mongo.WriteConcernError
+
+	// The error of the first failing chunk, a mongo.BulkWriteException or another error of the driver.
+	Err error
+}
+
+// Error implements the error interface
+func (e *BulkError) Error() string {
+	if len(e.Errors) == 0 {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("bulk write: %d operations failed, operation %d: %s", len(e.Errors), e.Errors[0].Index, e.Errors[0].Message)
+}
+
+// Unwrap returns the error of the first failing chunk
+func (e *BulkError) Unwrap() error {
+	return e.Err
+}
+
+// add adds the error of the bulk write of the chunk starting at the index start of the queue of b
+func (e *BulkError) add(b *Bulk, err error, start int) {
+	if e.Err == nil {
+		e.Err = err
+	}
+
+	var exception mongo.BulkWriteException
+
+	if !errors.As(err, &exception) {
+		return
+	}
+
+	for _, we := range exception.WriteErrors {
+		i := start + we.Index
+
+		e.Errors = append(e.Errors, BulkWriteError{
+			Index:     i,
+			Code:      we.Code,
+			Message:   we.Message,
+			Kind:      bulkErrorKind(we.WriteError),
+			Model:     b.queue[i],
+			Operation: b.ops[i],
+		})
+	}
+
+	if exception.WriteConcernError != nil {
+		e.WriteConcernErrors = append(e.WriteConcernErrors, exception.WriteConcernError)
+	}
+}
+
+// bulkErrorKind classifies the write error we
+func bulkErrorKind(we mongo.WriteError) string {
+	switch {
+	case we.HasErrorCode(11000), we.HasErrorCode(11001), we.HasErrorCode(12582), strings.Contains(we.Message, "E11000"):
+		return BulkErrorDuplicateKey
+	case we.HasErrorCode(121):
+		return BulkErrorValidation
+	case we.HasErrorCode(112):
+		return BulkErrorWriteConflict
+	}
+
+	return BulkErrorOther
+}
+
 // Bulk is context for batching operations to be sent to database in a single
 // bulk write.
 //
@@ -36,28 +164,150 @@ type BulkResult struct {
 //
 // Notes:
 //
-// Individual operations inside a bulk do not trigger middlewares or hooks
-// at present.
+// Run calls the before-hooks of every queued document, then runs the field
+// and validator middlewares of the collection on its operation with the
+// context of Run, and builds the write model from the operation they leave,
+// so changed filters, documents and updates are written. The first operation
+// failing them is reported by Run as a *BulkOperationError, and Run does not
+// send anything then. The after-hooks run once the bulk write succeeded, the
+// Result of their operation is the *BulkResult. The history middleware runs
+// right before the bulk write, see HistoryHook. Other middlewares do not run
+// for the operations of a bulk.
 //
 // the godm implementation of Bulk does not emulate
 // bulk operations individually on old versions of MongoDB servers that do not
 // natively support bulk operations.
 //
-// Only operations supported by the official driver are exposed, that is why
-// InsertMany is missing from the methods.
+// Every write model of the official driver can be queued, with the collation,
+// hint, array filters and upsert options of each operation. InsertMany queues
+// one insert per document.
 type Bulk struct {
 	coll *Collection
 
-	queue   []mongo.WriteModel
-	ordered *bool
+	queue       []mongo.WriteModel
+	ops         []*middleware.Operation
+	prepared    int
+	ordered     *bool
+	chunkSize   int
+	concurrency int
+	err         error
 }
 
+// define the defaults of the chunks Bulk.Run writes
+const (
+	// DefaultBulkChunkSize is the number of operations Bulk.Run sends in one bulk write
+	DefaultBulkChunkSize = 1000
+	// DefaultBulkConcurrency is the number of chunks of an unordered bulk Bulk.Run writes at once
+	DefaultBulkConcurrency = 4
+)
+
 // Bulk returns a new context for preparing bulk execution of operations.
 func (c *Collection) Bulk() *Bulk {
 	return &Bulk{
-		coll:    c,
-		queue:   nil,
-		ordered: nil,
+		coll:        c,
+		queue:       nil,
+		ordered:     nil,
+		chunkSize:   DefaultBulkChunkSize,
+		concurrency: DefaultBulkConcurrency,
+	}
+}
+
+// Err returns the first operation which could not be queued, like an UpdateBuilder with an error, as a
+// *BulkOperationError
+func (b *Bulk) Err() error {
+	return b.err
+}
+
+// add queues a write model, op describes it for the middlewares and hooks and can be nil
+func (b *Bulk) add(wm mongo.WriteModel, op *middleware.Operation) *Bulk {
+	if op != nil {
+		op.Database = b.coll.collection.Database().Name()
+		op.Collection = b.coll.collection.Name()
+	}
+
+	b.queue = append(b.queue, wm)
+	b.ops = append(b.ops, op)
+
+	return b
+}
+
+// prepare runs the before-hooks and the field and validator middlewares on the operations queued since the last
+// call, and sets their write models to the operations they leave
+func (b *Bulk) prepare(ctx context.Context) error {
+	noop := func(ctx context.Context, op *middleware.Operation) error {
+		return nil
+	}
+
+	chain := b.coll.middleware.Only(middleware.Field, middleware.Validator)
+
+	for ; b.prepared < len(b.ops); b.prepared++ {
+		op := b.ops[b.prepared]
+
+		if op == nil {
+			continue
+		}
+
+		if err := hook.Before(ctx, op); err != nil {
+			return &BulkOperationError{Index: b.prepared, Err: err}
+		}
+
+		if err := chain.Run(ctx, op, noop); err != nil {
+			return &BulkOperationError{Index: b.prepared, Err: err}
+		}
+
+		b.setModel(b.prepared, op)
+	}
+
+	return nil
+}
+
+// history runs the history middleware on the queued operations, so the documents they change are copied to the
+// history collection of a model with history before the bulk write
+// A document changed by several operations of the bulk is recorded in its version before the bulk every time
+func (b *Bulk) history(ctx context.Context) error {
+	noop := func(ctx context.Context, op *middleware.Operation) error {
+		return nil
+	}
+
+	chain := b.coll.middleware.Only(middleware.History)
+
+	for i, op := range b.ops {
+		if op == nil {
+			continue
+		}
+
+		if err := chain.Run(ctx, op, noop); err != nil {
+			return &BulkOperationError{Index: i, Err: err}
+		}
+
+		b.setModel(i, op)
+	}
+
+	return nil
+}
+
+// setModel sets the write model queued at the index i to the operation op
+func (b *Bulk) setModel(i int, op *middleware.Operation) {
+	switch m := b.queue[i].(type) {
+	case *mongo.InsertOneModel:
+		m.SetDocument(op.Documents)
+	case *mongo.ReplaceOneModel:
+		m.SetFilter(op.Filter).SetReplacement(op.Documents)
+	case *mongo.UpdateOneModel:
+		m.SetFilter(op.Filter).SetUpdate(op.Update)
+	case *mongo.UpdateManyModel:
+		m.SetFilter(op.Filter).SetUpdate(op.Update)
+	case *mongo.DeleteOneModel:
+		m.SetFilter(op.Filter)
+	case *mongo.DeleteManyModel:
+		m.SetFilter(op.Filter)
+	}
+}
+
+// fail records err as the error of the operation queued next, unless an earlier operation failed
+func (b *Bulk) fail(err error) {
+	if err != nil && b.err == nil {
+		b.err = &BulkOperationError{Index: len(b.queue), Err: err}
 	}
 }
 
@@ -71,22 +321,76 @@ func (b *Bulk) SetOrdered(ordered bool) *Bulk {
 	return b
 }
 
+// SetChunkSize sets the number of operations Run sends in one bulk write, DefaultBulkChunkSize if n is less than 1
+func (b *Bulk) SetChunkSize(n int) *Bulk {
+	if n < 1 {
+		n = DefaultBulkChunkSize
+	}
+
+	b.chunkSize = n
+
+	return b
+}
+
+// SetConcurrency sets the number of chunks of an unordered bulk Run writes at once, 1 if n is less than 1
+// Ordered bulks and bulks run in a session write their chunks one after the other
+func (b *Bulk) SetConcurrency(n int) *Bulk {
+	if n < 1 {
+		n = 1
+	}
+
+	b.concurrency = n
+
+	return b
+}
+
 // InsertOne queues an InsertOne operation for bulk execution.
 func (b *Bulk) InsertOne(doc interface{}) *Bulk {
 	wm := mongo.NewInsertOneModel().SetDocument(doc)
 
-	b.queue = append(b.queue, wm)
+	return b.add(wm, &middleware.Operation{Type: operator.OpInsert, Documents: doc, Hook: doc})
+}
+
+// InsertMany queues an InsertOne operation for every document of the slice docs for bulk execution.
+// Structs of the slice are queued by their address, so the fields set by godm, like ids, are set in docs
+func (b *Bulk) InsertMany(docs interface{}) *Bulk {
+	v := reflect.Indirect(reflect.ValueOf(docs))
+
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		b.fail(ErrNotValidSliceToInsert)
+
+		return b
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		doc := v.Index(i)
+
+		if doc.Kind() == reflect.Struct && doc.CanAddr() {
+			doc = doc.Addr()
+		}
+
+		b.InsertOne(doc.Interface())
+	}
 
 	return b
 }
 
 // Remove queues a Remove operation for bulk execution.
-func (b *Bulk) Remove(filter interface{}) *Bulk {
+func (b *Bulk) Remove(filter interface{}, opts ...gOpts.BulkDeleteOptions) *Bulk {
+	return b.DeleteOne(filter, opts...)
+}
+
+// DeleteOne queues the delete of at most one document matching filter for bulk execution.
+func (b *Bulk) DeleteOne(filter interface{}, opts ...gOpts.BulkDeleteOptions) *Bulk {
 	wm := mongo.NewDeleteOneModel().SetFilter(filter)
 
-	b.queue = append(b.queue, wm)
+	if len(opts) > 0 {
+		wm.Collation, wm.Hint = opts[0].Collation, opts[0].Hint
+	}
 
-	return b
+	o := &options.DeleteOptions{Collation: wm.Collation, Hint: wm.Hint}
+
+	return b.add(wm, &middleware.Operation{Type: operator.OpRemove, Filter: filter, Options: o})
 }
 
 // RemoveId queues a RemoveId operation for bulk execution.
@@ -97,22 +401,44 @@ func (b *Bulk) RemoveId(id interface{}) *Bulk {
 }
 
 // RemoveAll queues a RemoveAll operation for bulk execution.
-func (b *Bulk) RemoveAll(filter interface{}) *Bulk {
+func (b *Bulk) RemoveAll(filter interface{}, opts ...gOpts.BulkDeleteOptions) *Bulk {
 	wm := mongo.NewDeleteManyModel().SetFilter(filter)
 
-	b.queue = append(b.queue, wm)
+	if len(opts) > 0 {
+		wm.Collation, wm.Hint = opts[0].Collation, opts[0].Hint
+	}
 
-	return b
+	o := &options.DeleteOptions{Collation: wm.Collation, Hint: wm.Hint}
+
+	return b.add(wm, &middleware.Operation{Type: operator.OpRemove, Filter: filter, Many: true, Options: o})
+}
+
+// ReplaceOne queues the replace of at most one document matching filter for bulk execution.
+// The replacement should be document without operator, it is inserted if no document matches and Upsert is set
+func (b *Bulk) ReplaceOne(filter interface{}, replacement interface{}, opts ...gOpts.BulkReplaceOptions) *Bulk {
+	wm := mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement)
+
+	opType := operator.OpReplace
+
+	if len(opts) > 0 {
+		wm.Collation, wm.Hint, wm.Upsert = opts[0].Collation, opts[0].Hint, opts[0].Upsert
+
+		if wm.Upsert != nil && *wm.Upsert {
+			opType = operator.OpUpsert
+		}
+	}
+
+	o := &options.ReplaceOptions{Collation: wm.Collation, Hint: wm.Hint, Upsert: wm.Upsert}
+
+	return b.add(wm, &middleware.Operation{Type: opType, Filter: filter, Documents: replacement, Hook: replacement, Options: o})
 }
 
 // Upsert queues an Upsert operation for bulk execution.
 // The replacement should be document without operator
 func (b *Bulk) Upsert(filter interface{}, replacement interface{}) *Bulk {
-	wm := mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement).SetUpsert(true)
+	upsert := true
 
-	b.queue = append(b.queue, wm)
-
-	return b
+	return b.ReplaceOne(filter, replacement, gOpts.BulkReplaceOptions{Upsert: &upsert})
 }
 
 // UpsertId queues an UpsertId operation for bulk execution.
@@ -124,58 +450,245 @@ func (b *Bulk) UpsertId(id interface{}, replacement interface{}) *Bulk {
 }
 
 // UpdateOne queues an UpdateOne operation for bulk execution.
-// The update should contain operator
-func (b *Bulk) UpdateOne(filter interface{}, update interface{}) *Bulk {
+// The update should contain operator, or be an UpdateBuilder or an update pipeline like mongo.Pipeline
+func (b *Bulk) UpdateOne(filter interface{}, update interface{}, opts ...gOpts.BulkUpdateOptions) *Bulk {
+	update, arrayFilters, err := updateOf(update)
+
+	b.fail(err)
+
+	o := bulkUpdateOptions(arrayFilters, opts)
+
 	wm := mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
 
-	b.queue = append(b.queue, wm)
+	wm.Collation, wm.Hint, wm.ArrayFilters, wm.Upsert = o.Collation, o.Hint, o.ArrayFilters, o.Upsert
 
-	return b
+	return b.add(wm, &middleware.Operation{Type: operator.OpUpdate, Filter: filter, Update: update, Model: b.coll.model(), Options: o})
 }
 
 // UpdateId queues an UpdateId operation for bulk execution.
 // The update should contain operator
-func (b *Bulk) UpdateId(id interface{}, update interface{}) *Bulk {
-	b.UpdateOne(bson.M{"_id": id}, update)
+func (b *Bulk) UpdateId(id interface{}, update interface{}, opts ...gOpts.BulkUpdateOptions) *Bulk {
+	b.UpdateOne(bson.M{"_id": id}, update, opts...)
 
 	return b
 }
 
 // UpdateAll queues an UpdateAll operation for bulk execution.
-// The update should contain operator
-func (b *Bulk) UpdateAll(filter interface{}, update interface{}) *Bulk {
+// The update should contain operator, or be an UpdateBuilder or an update pipeline like mongo.Pipeline
+func (b *Bulk) UpdateAll(filter interface{}, update interface{}, opts ...gOpts.BulkUpdateOptions) *Bulk {
+	update, arrayFilters, err := updateOf(update)
+
+	b.fail(err)
+
+	o := bulkUpdateOptions(arrayFilters, opts)
+
 	wm := mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update)
 
-	b.queue = append(b.queue, wm)
+	wm.Collation, wm.Hint, wm.ArrayFilters, wm.Upsert = o.Collation, o.Hint, o.ArrayFilters, o.Upsert
 
-	return b
+	return b.add(wm, &middleware.Operation{Type: operator.OpUpdate, Filter: filter, Many: true, Update: update, Model: b.coll.model(), Options: o})
 }
 
-// Run executes the collected operations in a single bulk operation.
+// bulkUpdateOptions returns the options of a queued update, the array filters of its UpdateBuilder are added to
+// the ones of opts
+func bulkUpdateOptions(arrayFilters []interface{}, opts []gOpts.BulkUpdateOptions) *options.UpdateOptions {
+	o := options.Update()
+
+	if len(opts) > 0 {
+		o.Collation, o.Hint, o.ArrayFilters, o.Upsert = opts[0].Collation, opts[0].Hint, opts[0].ArrayFilters, opts[0].Upsert
+	}
+
+	if arrayFilters != nil {
+		filters := options.ArrayFilters{Filters: arrayFilters}
+
+		if o.ArrayFilters != nil {
+			filters.Registry = o.ArrayFilters.Registry
+			filters.Filters = append(append([]interface{}{}, o.ArrayFilters.Filters...), arrayFilters...)
+		}
+
+		o.ArrayFilters = &filters
+	}
+
+	return o
+}
+
+// Run executes the collected operations in bulk writes of SetChunkSize operations.
+// The chunks of an ordered bulk are written one after the other and Run stops at
+// the first failing chunk. The chunks of an unordered bulk are written
+// SetConcurrency at a time, outside of sessions. The results of the chunks are
+// merged, with the indexes of UpsertedIDs in the whole queue.
+//
+// If the server rejects operations, the *BulkResult of the written ones is
+// returned with a *BulkError listing the failures by their index in the queue.
 //
 // A successful call resets the Bulk. If an error is returned, the internal
 // queue of operations is unchanged, containing both successful and failed
 // operations.
 func (b *Bulk) Run(ctx context.Context) (*BulkResult, error) {
-	opts := options.BulkWriteOptions{
-		Ordered: b.ordered,
+	if b.err != nil {
+		return nil, b.err
 	}
 
-	result, err := b.coll.collection.BulkWrite(ctx, b.queue, &opts)
+	if err := b.prepare(ctx); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	if err := b.history(ctx); err != nil {
 		return nil, err
 	}
 
+	bulkResult, err := b.write(ctx)
+
+	if err != nil {
+		return bulkResult, err
+	}
+
+	ops := b.ops
+
 	// Empty the queue for possible reuse.
 	b.queue = nil
+	b.ops = nil
+	b.prepared = 0
+
+	for i, op := range ops {
+		if op == nil {
+			continue
+		}
+
+		op.Result = bulkResult
+
+		if err := afterHooks(ctx, op); err != nil {
+			return bulkResult, &BulkOperationError{Index: i, Err: err}
+		}
+	}
 
-	return &BulkResult{
-		InsertedCount: result.InsertedCount,
-		MatchedCount:  result.MatchedCount,
-		ModifiedCount: result.ModifiedCount,
-		DeletedCount:  result.DeletedCount,
-		UpsertedCount: result.UpsertedCount,
-		UpsertedIDs:   result.UpsertedIDs,
-	}, nil
+	return bulkResult, nil
+}
+
+// write writes the queue in chunks and merges their results, the errors of the chunks are returned as a *BulkError
+func (b *Bulk) write(ctx context.Context) (*BulkResult, error) {
+	size := b.chunkSize
+
+	if size < 1 {
+		size = DefaultBulkChunkSize
+	}
+
+	if len(b.queue) == 0 {
+		return nil, mongo.ErrEmptySlice
+	}
+
+	var starts []int
+
+	for start := 0; start < len(b.queue); start += size {
+		starts = append(starts, start)
+	}
+
+	opts := options.BulkWriteOptions{
+		Ordered: b.ordered,
+	}
+
+	ordered := b.ordered == nil || *b.ordered
+
+	result := &BulkResult{UpsertedIDs: make(map[int64]interface{})}
+
+	errs := make([]error, len(starts))
+
+	var mu sync.Mutex
+
+	run := func(i int) error {
+		start := starts[i]
+
+		end := start + size
+
+		if end > len(b.queue) {
+			end = len(b.queue)
+		}
+
+		res, err := b.coll.collection.BulkWrite(ctx, b.queue[start:end], &opts)
+
+		if res != nil {
+			mu.Lock()
+			result.merge(res, start)
+			mu.Unlock()
+		}
+
+		errs[i] = err
+
+		return err
+	}
+
+	workers := b.concurrency
+
+	if ordered || mongo.SessionFromContext(ctx) != nil {
+		workers = 1
+	}
+
+	if workers > len(starts) {
+		workers = len(starts)
+	}
+
+	if workers <= 1 {
+		for i := range starts {
+			if err := run(i); err != nil && ordered {
+				break
+			}
+		}
+	} else {
+		chunks := make(chan int)
+
+		var wg sync.WaitGroup
+
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for i := range chunks {
+					run(i)
+				}
+			}()
+		}
+
+		for i := range starts {
+			chunks <- i
+		}
+
+		close(chunks)
+
+		wg.Wait()
+	}
+
+	var bulkErr *BulkError
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if bulkErr == nil {
+			bulkErr = &BulkError{}
+		}
+
+		bulkErr.add(b, err, starts[i])
+	}
+
+	if bulkErr != nil {
+		return result, bulkErr
+	}
+
+	return result, nil
+}
+
+// merge adds the result of the bulk write of the chunk starting at the index start of the queue
+func (r *BulkResult) merge(res *mongo.BulkWriteResult, start int) {
+	r.InsertedCount += res.InsertedCount
+	r.MatchedCount += res.MatchedCount
+	r.ModifiedCount += res.ModifiedCount
+	r.DeletedCount += res.DeletedCount
+	r.UpsertedCount += res.UpsertedCount
+
+	for i, id := range res.UpsertedIDs {
+		r.UpsertedIDs[int64(start)+i] = id
+	}
 }
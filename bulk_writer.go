@@ -0,0 +1,354 @@
+package godm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BulkWriterOptions configures a BulkWriter
+type BulkWriterOptions struct {
+	// MaxOperations is the number of buffered operations which triggers a flush. The default is 1000.
+	MaxOperations int
+	// MaxBytes is the BSON size of the buffered operations which triggers a flush. The default is 8 MiB.
+	MaxBytes int
+	// FlushInterval is the time after which the buffered operations are flushed anyway. The default is 1 second.
+	FlushInterval time.Duration
+	// MaxPendingFlushes is the number of full buffers which wait for the flush in progress, Write blocks once it is
+	// reached. The default is 1.
+	MaxPendingFlushes int
+	// Ordered writes the operations of a flush in order, stopping at the first failure. The default is unordered.
+	Ordered bool
+	// OnFlush is called with the outcome of every flush. Writes do not wait for room while it runs, so it may call
+	// Write, but not Close.
+	OnFlush func(flush *BulkFlush)
+}
+
+// BulkFlush is the outcome of a flush of a BulkWriter
+type BulkFlush struct {
+	// Operations is the number of flushed operations.
+	Operations int
+	// Result is the result of the bulk write, partial if Err is a *BulkError.
+	Result *BulkResult
+	// Err is the error of Bulk.Run, its indexes are the ones of the operations in the flush.
+	Err error
+}
+
+// BulkWriter buffers the operations of many goroutines and writes them in bulks
+// The buffer is flushed once MaxOperations operations or MaxBytes bytes are buffered, and every FlushInterval.
+// Flushes run one after the other in the background with context.Background, the before-hooks and the field and
+// validator middlewares of an operation run with the context of its Write, the history middleware with the one of
+// its flush, so the revisions it records have no actor
+type BulkWriter struct {
+	coll *Collection
+	opts BulkWriterOptions
+
+	mu       sync.Mutex
+	bulk     *Bulk
+	bytes    int
+	closed   bool
+	flushing bool           // OnFlush is running
+	sending  sync.WaitGroup // Writes handing a full buffer to the flushes
+	flushes  chan *Bulk
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// BulkWriter creates a BulkWriter of the collection and starts its background flushes, call Close to stop it
+func (c *Collection) BulkWriter(opts ...BulkWriterOptions) *BulkWriter {
+	var o BulkWriterOptions
+
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.MaxOperations <= 0 {
+		o.MaxOperations = 1000
+	}
+
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = 8 << 20
+	}
+
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+
+	if o.MaxPendingFlushes <= 0 {
+		o.MaxPendingFlushes = 1
+	}
+
+	w := &BulkWriter{
+		coll:    c,
+		opts:    o,
+		flushes: make(chan *Bulk, o.MaxPendingFlushes),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	w.bulk = w.newBulk()
+
+	go w.flushLoop()
+	go w.tickLoop()
+
+	return w
+}
+
+// Write buffers the operations op queues in a Bulk, like
+// w.Write(ctx, func(b *godm.Bulk) { b.InsertOne(doc) })
+// If the buffer is full, Write waits for room until ctx is done. An operation failing its before-hooks, field handling
+// or validation is not buffered and its error is returned. ErrBulkWriterClosed is returned once Close was called
+func (w *BulkWriter) Write(ctx context.Context, op func(b *Bulk)) error {
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+
+	if closed {
+		return ErrBulkWriterClosed
+	}
+
+	b := w.coll.Bulk()
+
+	op(b)
+
+	if err := b.Err(); err != nil {
+		return err.(*BulkOperationError).Err
+	}
+
+	if err := b.prepare(ctx); err != nil {
+		return err.(*BulkOperationError).Err
+	}
+
+	if err := w.room(ctx); err != nil {
+		return err
+	}
+
+	defer w.mu.Unlock()
+
+	w.bulk.queue = append(w.bulk.queue, b.queue...)
+	w.bulk.ops = append(w.bulk.ops, b.ops...)
+	w.bulk.prepared = len(w.bulk.ops)
+
+	for _, wm := range b.queue {
+		w.bytes += w.modelSize(wm)
+	}
+
+	if w.full() {
+		select {
+		case w.flushes <- w.bulk:
+			w.reset()
+		default:
+		}
+	}
+
+	return nil
+}
+
+// room waits until the buffer has room, or OnFlush is running, and returns with w.mu locked
+// A full buffer is handed to the flushes outside of the lock, and put back if ctx is done or Close is called first
+func (w *BulkWriter) room(ctx context.Context) error {
+	for {
+		w.mu.Lock()
+
+		if w.closed {
+			w.mu.Unlock()
+
+			return ErrBulkWriterClosed
+		}
+
+		if !w.full() || w.flushing {
+			return nil
+		}
+
+		full, bytes := w.bulk, w.bytes
+
+		w.reset()
+
+		w.sending.Add(1)
+
+		w.mu.Unlock()
+
+		var err error
+
+		select {
+		case w.flushes <- full:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-w.stop:
+			err = ErrBulkWriterClosed
+		}
+
+		if err != nil {
+			w.restore(full, bytes)
+		}
+
+		w.sending.Done()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// restore puts the operations of the Bulk b, whose size is bytes, back in front of the buffer
+func (w *BulkWriter) restore(b *Bulk, bytes int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.bulk.queue = append(b.queue, w.bulk.queue...)
+	w.bulk.ops = append(b.ops, w.bulk.ops...)
+	w.bulk.prepared = len(w.bulk.ops)
+	w.bytes += bytes
+}
+
+// Close flushes the buffered operations and waits for the flushes in progress until ctx is done
+// If ctx is done before the buffer is handed to the flushes, its operations are dropped
+func (w *BulkWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+
+	if w.closed {
+		w.mu.Unlock()
+
+		return ErrBulkWriterClosed
+	}
+
+	w.closed = true
+
+	close(w.stop)
+
+	w.mu.Unlock()
+
+	// the Writes handing a full buffer put it back once they see stop
+	w.sending.Wait()
+
+	w.mu.Lock()
+	b := w.bulk
+	w.reset()
+	w.mu.Unlock()
+
+	if len(b.queue) > 0 {
+		select {
+		case w.flushes <- b:
+		case <-ctx.Done():
+			close(w.flushes)
+
+			return ctx.Err()
+		}
+	}
+
+	close(w.flushes)
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newBulk returns the empty Bulk of the buffer
+func (w *BulkWriter) newBulk() *Bulk {
+	return w.coll.Bulk().SetOrdered(w.opts.Ordered)
+}
+
+// reset empties the buffer after its Bulk was handed to the flushes
+func (w *BulkWriter) reset() {
+	w.bulk = w.newBulk()
+	w.bytes = 0
+}
+
+// full checks if the buffer reached MaxOperations or MaxBytes
+func (w *BulkWriter) full() bool {
+	return len(w.bulk.queue) >= w.opts.MaxOperations || w.bytes >= w.opts.MaxBytes
+}
+
+// flushLoop writes the handed bulks until Close
+func (w *BulkWriter) flushLoop() {
+	defer close(w.done)
+
+	for b := range w.flushes {
+		n := len(b.queue)
+
+		result, err := b.Run(context.Background())
+
+		if w.opts.OnFlush != nil {
+			w.setFlushing(true)
+			w.opts.OnFlush(&BulkFlush{Operations: n, Result: result, Err: err})
+			w.setFlushing(false)
+		}
+	}
+}
+
+// tickLoop hands the buffered operations to the flushes every FlushInterval until Close
+func (w *BulkWriter) tickLoop() {
+	ticker := time.NewTicker(w.opts.FlushInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		w.mu.Lock()
+
+		// a flush in progress or pending takes the buffer at a later tick
+		if !w.closed && len(w.bulk.queue) > 0 {
+			select {
+			case w.flushes <- w.bulk:
+				w.reset()
+			default:
+			}
+		}
+
+		w.mu.Unlock()
+	}
+}
+
+// setFlushing records if OnFlush is running
+func (w *BulkWriter) setFlushing(flushing bool) {
+	w.mu.Lock()
+	w.flushing = flushing
+	w.mu.Unlock()
+}
+
+// modelSize returns the BSON size of the documents of the write model wm
+func (w *BulkWriter) modelSize(wm mongo.WriteModel) int {
+	var values []interface{}
+
+	switch m := wm.(type) {
+	case *mongo.InsertOneModel:
+		values = append(values, m.Document)
+	case *mongo.ReplaceOneModel:
+		values = append(values, m.Filter, m.Replacement)
+	case *mongo.UpdateOneModel:
+		values = append(values, m.Filter, m.Update)
+	case *mongo.UpdateManyModel:
+		values = append(values, m.Filter, m.Update)
+	case *mongo.DeleteOneModel:
+		values = append(values, m.Filter)
+	case *mongo.DeleteManyModel:
+		values = append(values, m.Filter)
+	}
+
+	size := 0
+
+	for _, v := range values {
+		var data []byte
+
+		if w.coll.registry != nil {
+			_, data, _ = bson.MarshalValueWithRegistry(w.coll.registry, v)
+		} else {
+			_, data, _ = bson.MarshalValue(v)
+		}
+
+		size += len(data)
+	}
+
+	return size
+}
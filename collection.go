@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/md-salehzadeh/godm/field"
 	"github.com/md-salehzadeh/godm/middleware"
 	"github.com/md-salehzadeh/godm/operator"
 	gOpts "github.com/md-salehzadeh/godm/options"
@@ -20,7 +21,36 @@ import (
 type Collection struct {
 	collection *mongo.Collection
 
-	registry *bsoncodec.Registry
+	registry   *bsoncodec.Registry
+	connection *Connection
+	middleware *middleware.Chain
+}
+
+// Middleware returns the middleware chain of this collection handle
+// Its middlewares run inside the ones of the database and the connection
+func (c *Collection) Middleware() *middleware.Chain {
+	return c.middleware
+}
+
+// do runs op through the middleware chain of the collection, exec performs the operation itself
+func (c *Collection) do(ctx context.Context, op *middleware.Operation, exec middleware.Handler) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	op.Database = c.collection.Database().Name()
+	op.Collection = c.collection.Name()
+
+	return c.middleware.Run(ctx, op, exec)
+}
+
+// model returns the document of the model registered for the collection, nil if there is none
+func (c *Collection) model() interface{} {
+	if c.connection == nil {
+		return nil
+	}
+
+	return c.connection.modelOf(c.collection.Database().Name(), c.collection.Name())
 }
 
 // Find find by condition filter，return QueryI
@@ -29,6 +59,8 @@ func (c *Collection) Find(opts ...gOpts.FindOptions) QueryI {
 		collection: c.collection,
 		opts:       opts,
 		registry:   c.registry,
+		model:      c.model(),
+		middleware: c.middleware,
 	}
 }
 
@@ -50,23 +82,23 @@ func (c *Collection) InsertOne(ctx context.Context, doc interface{}, opts ...gOp
 		}
 	}
 
-	if err = middleware.Do(ctx, doc, operator.BeforeInsert, h); err != nil {
-		return
+	op := &middleware.Operation{
+		Type:      operator.OpInsert,
+		Documents: doc,
+		Hook:      h,
+		Options:   insertOneOpts,
 	}
 
-	res, err := c.collection.InsertOne(ctx, doc, insertOneOpts)
+	err = c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		res, err := c.collection.InsertOne(ctx, op.Documents, insertOneOpts)
 
-	if res != nil {
-		result = &InsertOneResult{InsertedID: res.InsertedID}
-	}
-
-	if err != nil {
-		return
-	}
+		if res != nil {
+			result = &InsertOneResult{InsertedID: res.InsertedID}
+			op.Result = result
+		}
 
-	if err = middleware.Do(ctx, doc, operator.AfterInsert, h); err != nil {
-		return
-	}
+		return err
+	})
 
 	return
 }
@@ -89,29 +121,29 @@ func (c *Collection) InsertMany(ctx context.Context, docs interface{}, opts ...g
 		}
 	}
 
-	if err = middleware.Do(ctx, docs, operator.BeforeInsert, h); err != nil {
-		return
+	op := &middleware.Operation{
+		Type:      operator.OpInsert,
+		Documents: docs,
+		Hook:      h,
+		Options:   insertManyOpts,
 	}
 
-	sDocs := interfaceToSliceInterface(docs)
-
-	if sDocs == nil {
-		return nil, ErrNotValidSliceToInsert
-	}
+	err = c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		sDocs := interfaceToSliceInterface(op.Documents)
 
-	res, err := c.collection.InsertMany(ctx, sDocs, insertManyOpts)
+		if sDocs == nil {
+			return ErrNotValidSliceToInsert
+		}
 
-	if res != nil {
-		result = &InsertManyResult{InsertedIDs: res.InsertedIDs}
-	}
+		res, err := c.collection.InsertMany(ctx, sDocs, insertManyOpts)
 
-	if err != nil {
-		return
-	}
+		if res != nil {
+			result = &InsertManyResult{InsertedIDs: res.InsertedIDs}
+			op.Result = result
+		}
 
-	if err = middleware.Do(ctx, docs, operator.AfterInsert, h); err != nil {
-		return
-	}
+		return err
+	})
 
 	return
 }
@@ -160,23 +192,24 @@ func (c *Collection) Upsert(ctx context.Context, filter interface{}, replacement
 		}
 	}
 
-	if err = middleware.Do(ctx, replacement, operator.BeforeUpsert, h); err != nil {
-		return
+	op := &middleware.Operation{
+		Type:      operator.OpUpsert,
+		Filter:    filter,
+		Documents: replacement,
+		Hook:      h,
+		Options:   officialOpts,
 	}
 
-	res, err := c.collection.ReplaceOne(ctx, filter, replacement, officialOpts)
-
-	if res != nil {
-		result = translateUpdateResult(res)
-	}
+	err = c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		res, err := c.collection.ReplaceOne(ctx, op.Filter, op.Documents, officialOpts)
 
-	if err != nil {
-		return
-	}
+		if res != nil {
+			result = translateUpdateResult(res)
+			op.Result = result
+		}
 
-	if err = middleware.Do(ctx, replacement, operator.AfterUpsert, h); err != nil {
-		return
-	}
+		return err
+	})
 
 	return
 }
@@ -186,149 +219,158 @@ func (c *Collection) Upsert(ctx context.Context, filter interface{}, replacement
 // and cannot contain any update operators
 // Reference: https://docs.mongodb.com/manual/reference/operator/update/
 func (c *Collection) UpsertId(ctx context.Context, id interface{}, replacement interface{}, opts ...gOpts.UpsertOptions) (result *UpdateResult, err error) {
-	h := replacement
-
-	officialOpts := options.Replace().SetUpsert(true)
-
-	if len(opts) > 0 {
-		if opts[0].ReplaceOptions != nil {
-			opts[0].ReplaceOptions.SetUpsert(true)
-
-			officialOpts = opts[0].ReplaceOptions
-		}
-
-		if opts[0].UpsertHook != nil {
-			h = opts[0].UpsertHook
-		}
-	}
-
-	if err = middleware.Do(ctx, replacement, operator.BeforeUpsert, h); err != nil {
-		return
-	}
-
-	res, err := c.collection.ReplaceOne(ctx, bson.M{"_id": id}, replacement, officialOpts)
-
-	if res != nil {
-		result = translateUpdateResult(res)
-	}
-
-	if err != nil {
-		return
-	}
-
-	if err = middleware.Do(ctx, replacement, operator.AfterUpsert, h); err != nil {
-		return
-	}
-
-	return
+	return c.Upsert(ctx, bson.M{"_id": id}, replacement, opts...)
 }
 
 // UpdateOne executes an update command to update at most one document in the collection.
+// The update is a document with operators or an UpdateBuilder
 // Reference: https://docs.mongodb.com/manual/reference/operator/update/
 func (c *Collection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...gOpts.UpdateOptions) (err error) {
 	updateOpts := options.Update()
 
+	var h interface{}
+
 	if len(opts) > 0 {
 		if opts[0].UpdateOptions != nil {
 			updateOpts = opts[0].UpdateOptions
 		}
 
-		if opts[0].UpdateHook != nil {
-			if err = middleware.Do(ctx, opts[0].UpdateHook, operator.BeforeUpdate); err != nil {
-				return
-			}
-		}
+		h = opts[0].UpdateHook
 	}
 
-	res, err := c.collection.UpdateOne(ctx, filter, update, updateOpts)
+	update, arrayFilters, err := updateOf(update)
 
-	if res != nil && res.MatchedCount == 0 {
-		err = ErrNoSuchDocuments
+	if err != nil {
+		return
 	}
 
-	if err != nil {
-		return err
+	if arrayFilters != nil {
+		updateOpts = options.MergeUpdateOptions(updateOpts, options.Update().SetArrayFilters(options.ArrayFilters{Filters: arrayFilters}))
 	}
 
-	if len(opts) > 0 && opts[0].UpdateHook != nil {
-		if err = middleware.Do(ctx, opts[0].UpdateHook, operator.AfterUpdate); err != nil {
-			return
-		}
+	model := c.model()
+
+	if len(opts) > 0 && opts[0].Model != nil {
+		model = opts[0].Model
 	}
 
-	return err
-}
+	op := &middleware.Operation{
+		Type:    operator.OpUpdate,
+		Filter:  filter,
+		Update:  update,
+		Hook:    h,
+		Model:   model,
+		Options: updateOpts,
+	}
 
-// UpdateId executes an update command to update at most one document in the collection.
-// Reference: https://docs.mongodb.com/manual/reference/operator/update/
-func (c *Collection) UpdateId(ctx context.Context, id interface{}, update interface{}, opts ...gOpts.UpdateOptions) (err error) {
-	updateOpts := options.Update()
+	return c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		res, err := c.collection.UpdateOne(ctx, op.Filter, op.Update, updateOpts)
 
-	if len(opts) > 0 {
-		if opts[0].UpdateOptions != nil {
-			updateOpts = opts[0].UpdateOptions
-		}
+		if res != nil {
+			op.Result = translateUpdateResult(res)
 
-		if opts[0].UpdateHook != nil {
-			if err = middleware.Do(ctx, opts[0].UpdateHook, operator.BeforeUpdate); err != nil {
-				return
+			if res.MatchedCount == 0 {
+				err = ErrNoSuchDocuments
 			}
 		}
-	}
 
-	res, err := c.collection.UpdateOne(ctx, bson.M{"_id": id}, update, updateOpts)
+		return err
+	})
+}
+
+// UpdateFromStruct updates at most one document with the fields of doc, a partially filled struct
+// The non-zero fields of doc, or the fields of the bson paths of the mask of opts, are set with their dotted paths,
+// like "address.city", and the nil pointers of the mask are unset, see field.Changes. The update runs as UpdateOne
+// with doc as the model, so the update middlewares and the validation of the model apply to it.
+// ErrNoFieldsToUpdate is returned if doc has no field to update
+func (c *Collection) UpdateFromStruct(ctx context.Context, filter interface{}, doc interface{}, opts ...gOpts.UpdateFromStructOptions) error {
+	var o gOpts.UpdateFromStructOptions
 
-	if res != nil && res.MatchedCount == 0 {
-		err = ErrNoSuchDocuments
+	if len(opts) > 0 {
+		o = opts[0]
 	}
 
+	update, err := field.Changes(doc, o.Mask)
+
 	if err != nil {
 		return err
 	}
 
-	if len(opts) > 0 && opts[0].UpdateHook != nil {
-		if err = middleware.Do(ctx, opts[0].UpdateHook, operator.AfterUpdate); err != nil {
-			return
+	if len(update) == 0 {
+		return ErrNoFieldsToUpdate
+	}
+
+	if o.Model == nil {
+		o.Model = doc
+
+		if t := reflect.TypeOf(doc); t.Kind() != reflect.Ptr {
+			o.Model = reflect.New(t).Interface()
 		}
 	}
 
-	return err
+	return c.UpdateOne(ctx, filter, update, o.UpdateOptions)
+}
+
+// UpdateId executes an update command to update at most one document in the collection.
+// Reference: https://docs.mongodb.com/manual/reference/operator/update/
+func (c *Collection) UpdateId(ctx context.Context, id interface{}, update interface{}, opts ...gOpts.UpdateOptions) (err error) {
+	return c.UpdateOne(ctx, bson.M{"_id": id}, update, opts...)
 }
 
 // UpdateAll executes an update command to update documents in the collection.
 // The matchedCount is 0 in UpdateResult if no document updated
+// The update is a document with operators or an UpdateBuilder
 // Reference: https://docs.mongodb.com/manual/reference/operator/update/
 func (c *Collection) UpdateAll(ctx context.Context, filter interface{}, update interface{}, opts ...gOpts.UpdateOptions) (result *UpdateResult, err error) {
 	updateOpts := options.Update()
 
+	var h interface{}
+
 	if len(opts) > 0 {
 		if opts[0].UpdateOptions != nil {
 			updateOpts = opts[0].UpdateOptions
 		}
 
-		if opts[0].UpdateHook != nil {
-			if err = middleware.Do(ctx, opts[0].UpdateHook, operator.BeforeUpdate); err != nil {
-				return
-			}
-		}
+		h = opts[0].UpdateHook
 	}
 
-	res, err := c.collection.UpdateMany(ctx, filter, update, updateOpts)
-
-	if res != nil {
-		result = translateUpdateResult(res)
-	}
+	update, arrayFilters, err := updateOf(update)
 
 	if err != nil {
 		return
 	}
 
-	if len(opts) > 0 && opts[0].UpdateHook != nil {
-		if err = middleware.Do(ctx, opts[0].UpdateHook, operator.AfterUpdate); err != nil {
-			return
-		}
+	if arrayFilters != nil {
+		updateOpts = options.MergeUpdateOptions(updateOpts, options.Update().SetArrayFilters(options.ArrayFilters{Filters: arrayFilters}))
+	}
+
+	model := c.model()
+
+	if len(opts) > 0 && opts[0].Model != nil {
+		model = opts[0].Model
+	}
+
+	op := &middleware.Operation{
+		Type:    operator.OpUpdate,
+		Filter:  filter,
+		Many:    true,
+		Update:  update,
+		Hook:    h,
+		Model:   model,
+		Options: updateOpts,
 	}
 
+	err = c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		res, err := c.collection.UpdateMany(ctx, op.Filter, op.Update, updateOpts)
+
+		if res != nil {
+			result = translateUpdateResult(res)
+			op.Result = result
+		}
+
+		return err
+	})
+
 	return
 }
 
@@ -350,25 +392,27 @@ func (c *Collection) ReplaceOne(ctx context.Context, filter interface{}, doc int
 		}
 	}
 
-	if err = middleware.Do(ctx, doc, operator.BeforeReplace, h); err != nil {
-		return
+	op := &middleware.Operation{
+		Type:      operator.OpReplace,
+		Filter:    filter,
+		Documents: doc,
+		Hook:      h,
+		Options:   replaceOpts,
 	}
 
-	res, err := c.collection.ReplaceOne(ctx, filter, doc, replaceOpts)
+	return c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		res, err := c.collection.ReplaceOne(ctx, op.Filter, op.Documents, replaceOpts)
 
-	if res != nil && res.MatchedCount == 0 {
-		err = ErrNoSuchDocuments
-	}
-
-	if err != nil {
-		return err
-	}
+		if res != nil {
+			op.Result = translateUpdateResult(res)
 
-	if err = middleware.Do(ctx, doc, operator.AfterReplace, h); err != nil {
-		return
-	}
+			if res.MatchedCount == 0 {
+				err = ErrNoSuchDocuments
+			}
+		}
 
-	return err
+		return err
+	})
 }
 
 // Remove executes a delete command to delete at most one document from the collection.
@@ -377,70 +421,41 @@ func (c *Collection) ReplaceOne(ctx context.Context, filter interface{}, doc int
 func (c *Collection) Remove(ctx context.Context, filter interface{}, opts ...gOpts.RemoveOptions) (err error) {
 	deleteOptions := options.Delete()
 
+	var h interface{}
+
 	if len(opts) > 0 {
 		if opts[0].DeleteOptions != nil {
 			deleteOptions = opts[0].DeleteOptions
 		}
 
-		if opts[0].RemoveHook != nil {
-			if err = middleware.Do(ctx, opts[0].RemoveHook, operator.BeforeRemove); err != nil {
-				return err
-			}
-		}
-	}
-
-	res, err := c.collection.DeleteOne(ctx, filter, deleteOptions)
-
-	if res != nil && res.DeletedCount == 0 {
-		err = ErrNoSuchDocuments
-	}
-
-	if err != nil {
-		return err
+		h = opts[0].RemoveHook
 	}
 
-	if len(opts) > 0 && opts[0].RemoveHook != nil {
-		if err = middleware.Do(ctx, opts[0].RemoveHook, operator.AfterRemove); err != nil {
-			return err
-		}
+	op := &middleware.Operation{
+		Type:    operator.OpRemove,
+		Filter:  filter,
+		Hook:    h,
+		Options: deleteOptions,
 	}
 
-	return err
-}
+	return c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		res, err := c.collection.DeleteOne(ctx, op.Filter, deleteOptions)
 
-// RemoveId executes a delete command to delete at most one document from the collection.
-func (c *Collection) RemoveId(ctx context.Context, id interface{}, opts ...gOpts.RemoveOptions) (err error) {
-	deleteOptions := options.Delete()
+		if res != nil {
+			op.Result = &DeleteResult{DeletedCount: res.DeletedCount}
 
-	if len(opts) > 0 {
-		if opts[0].DeleteOptions != nil {
-			deleteOptions = opts[0].DeleteOptions
-		}
-
-		if opts[0].RemoveHook != nil {
-			if err = middleware.Do(ctx, opts[0].RemoveHook, operator.BeforeRemove); err != nil {
-				return err
+			if res.DeletedCount == 0 {
+				err = ErrNoSuchDocuments
 			}
 		}
-	}
-
-	res, err := c.collection.DeleteOne(ctx, bson.M{"_id": id}, deleteOptions)
 
-	if res != nil && res.DeletedCount == 0 {
-		err = ErrNoSuchDocuments
-	}
-
-	if err != nil {
 		return err
-	}
-
-	if len(opts) > 0 && opts[0].RemoveHook != nil {
-		if err = middleware.Do(ctx, opts[0].RemoveHook, operator.AfterRemove); err != nil {
-			return err
-		}
-	}
+	})
+}
 
-	return err
+// RemoveId executes a delete command to delete at most one document from the collection.
+func (c *Collection) RemoveId(ctx context.Context, id interface{}, opts ...gOpts.RemoveOptions) (err error) {
+	return c.Remove(ctx, bson.M{"_id": id}, opts...)
 }
 
 // RemoveAll executes a delete command to delete documents from the collection.
@@ -449,33 +464,34 @@ func (c *Collection) RemoveId(ctx context.Context, id interface{}, opts ...gOpts
 func (c *Collection) RemoveAll(ctx context.Context, filter interface{}, opts ...gOpts.RemoveOptions) (result *DeleteResult, err error) {
 	deleteOptions := options.Delete()
 
+	var h interface{}
+
 	if len(opts) > 0 {
 		if opts[0].DeleteOptions != nil {
 			deleteOptions = opts[0].DeleteOptions
 		}
 
-		if opts[0].RemoveHook != nil {
-			if err = middleware.Do(ctx, opts[0].RemoveHook, operator.BeforeRemove); err != nil {
-				return
-			}
-		}
+		h = opts[0].RemoveHook
 	}
 
-	res, err := c.collection.DeleteMany(ctx, filter, deleteOptions)
-
-	if res != nil {
-		result = &DeleteResult{DeletedCount: res.DeletedCount}
+	op := &middleware.Operation{
+		Type:    operator.OpRemove,
+		Filter:  filter,
+		Many:    true,
+		Hook:    h,
+		Options: deleteOptions,
 	}
 
-	if err != nil {
-		return
-	}
+	err = c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		res, err := c.collection.DeleteMany(ctx, op.Filter, deleteOptions)
 
-	if len(opts) > 0 && opts[0].RemoveHook != nil {
-		if err = middleware.Do(ctx, opts[0].RemoveHook, operator.AfterRemove); err != nil {
-			return
+		if res != nil {
+			result = &DeleteResult{DeletedCount: res.DeletedCount}
+			op.Result = result
 		}
-	}
+
+		return err
+	})
 
 	return
 }
@@ -487,6 +503,7 @@ func (c *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts .
 		collection: c.collection,
 		pipeline:   pipeline,
 		options:    opts,
+		middleware: c.middleware,
 	}
 }
 
@@ -647,7 +664,32 @@ func (c *Collection) Watch(ctx context.Context, pipeline interface{}, opts ...*g
 		changeStreamOption = opts[0].ChangeStreamOptions
 	}
 
-	return c.collection.Watch(ctx, pipeline, changeStreamOption)
+	op := &middleware.Operation{
+		Type:     operator.OpWatch,
+		Pipeline: pipeline,
+		Options:  changeStreamOption,
+	}
+
+	var changeStream *mongo.ChangeStream
+
+	err := c.do(ctx, op, func(ctx context.Context, op *middleware.Operation) (err error) {
+		changeStream, err = c.collection.Watch(ctx, op.Pipeline, changeStreamOption)
+
+		op.Result = changeStream
+
+		return
+	})
+
+	if err != nil {
+		// a middleware failed after the change stream was opened
+		if changeStream != nil {
+			changeStream.Close(context.Background())
+		}
+
+		return nil, err
+	}
+
+	return changeStream, nil
 }
 
 // translateUpdateResult translates mongo update result to godm define UpdateResult
@@ -6,9 +6,13 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/md-salehzadeh/godm/field"
+	"github.com/md-salehzadeh/godm/middleware"
 	"github.com/md-salehzadeh/godm/options"
+	"github.com/md-salehzadeh/godm/validator"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -46,6 +50,15 @@ type Config struct {
 	ReadPreference *ReadPref `json:"readPreference"`
 	// can be used to provide authentication options when configuring a Client.
 	Auth *Credential `json:"auth"`
+	// Outbox is the name of the collection in Database which godm.Emit writes domain events to.
+	// The default is "outbox".
+	Outbox string `json:"outbox"`
+	// Counters is the name of the collection in Database which holds the counters of Connection.Sequence.
+	// The default is "counters".
+	Counters string `json:"counters"`
+	// Validation configures the validation of the operations of the connection.
+	// The default is the validator of the validator package, which validator.SetValidate changes for every connection.
+	Validation *validator.Config `json:"validation"`
 }
 
 // Credential can be used to provide authentication options when configuring a Client.
@@ -93,8 +106,12 @@ type Connection struct {
 	Config Config
 
 	registry      *bsoncodec.Registry
+	middleware    *middleware.Chain
+	validator     *validator.Validator
+	modelMu       sync.RWMutex
 	modelRegistry map[string]*Model
 	typeRegistry  map[string]reflect.Type
+	collModels    map[string]*Model // the models by "db.collection"
 }
 
 // Connect creates Godm MongoDB Connection
@@ -117,11 +134,53 @@ func Connect(ctx context.Context, conf *Config, _opts ...options.ClientOptions)
 		registry:      options.Registry,
 		modelRegistry: make(map[string]*Model),
 		typeRegistry:  make(map[string]reflect.Type),
+		collModels:    make(map[string]*Model),
 	}
 
+	if conf.Validation != nil {
+		if connection.validator, err = validator.New(*conf.Validation); err != nil {
+			return nil, err
+		}
+	}
+
+	connection.middleware = newMiddleware(connection)
+
 	return connection, nil
 }
 
+// newMiddleware creates the middleware chain of a connection
+// Hooks, field handling, validation, history and the callbacks registered by middleware.Register run in this order
+func newMiddleware(c *Connection) *middleware.Chain {
+	chain := middleware.NewChain(nil)
+
+	chain.Use(middleware.Hook, middleware.Func(handleHooks))
+	chain.Use(middleware.Field, middleware.Func(field.Handle))
+	chain.Use(middleware.Validator, middleware.Func(c.handleValidation))
+	chain.Use(middleware.History, middleware.Func(c.handleHistory))
+	chain.Use(middleware.Callbacks, middleware.Callback(middleware.RunCallbacks))
+
+	return chain
+}
+
+// Validator returns the validator of the connection
+func (c *Connection) Validator() *validator.Validator {
+	if c.validator == nil {
+		return validator.Default()
+	}
+
+	return c.validator
+}
+
+// handleValidation is the validator middleware of the connection
+// The database-aware validation rules query the database of the operation
+func (c *Connection) handleValidation(ctx context.Context, op *middleware.Operation, next middleware.Handler) error {
+	if op.Database != "" {
+		ctx = validator.WithDatabase(ctx, c.Client.Database(op.Database))
+	}
+
+	return c.Validator().Handle(ctx, op, next)
+}
+
 // creates connection to MongoDB
 func client(ctx context.Context, opts *opts.ClientOptions) (*mongo.Client, error) {
 	client, err := mongo.Connect(ctx, opts)
@@ -313,7 +372,18 @@ func (c *Connection) Database(name string, options ...*options.DatabaseOptions)
 		}
 	}
 
-	return &Database{database: c.Client.Database(name, opts), registry: c.registry}
+	return &Database{
+		database:   c.Client.Database(name, opts),
+		registry:   c.registry,
+		connection: c,
+		middleware: middleware.NewChain(c.middleware),
+	}
+}
+
+// Middleware returns the middleware chain of the connection
+// Its middlewares wrap every operation of the databases and collections created from the connection
+func (c *Connection) Middleware() *middleware.Chain {
+	return c.middleware
 }
 
 // creates one session on client
@@ -327,7 +397,7 @@ func (c *Connection) Session(_opts ...*options.SessionOptions) (*Session, error)
 
 	s, err := c.Client.StartSession(sessionOpts)
 
-	return &Session{session: s}, err
+	return &Session{session: s, connection: c}, err
 }
 
 // DoTransaction do whole transaction in one function
@@ -341,6 +411,8 @@ func (c *Connection) Session(_opts ...*options.SessionOptions) (*Session, error)
 //   the whole transaction will retry, so this transaction must be idempotent
 // - if operations in callback return godm.ErrTransactionNotSupported,
 // - If the ctx parameter already has a Session attached to it, it will be replaced by this session.
+// - after-hooks of operations in callback and callbacks registered with godm.OnCommit run once the transaction
+//   committed, callbacks registered with godm.OnRollback once it aborted
 func (c *Connection) DoTransaction(ctx context.Context, callback func(sessCtx context.Context) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error) {
 	if !c.transactionAllowed() {
 		return nil, ErrTransactionNotSupported
@@ -3,6 +3,7 @@ package godm
 import (
 	"context"
 
+	"github.com/md-salehzadeh/godm/middleware"
 	opts "github.com/md-salehzadeh/godm/options"
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -13,7 +14,9 @@ import (
 type Database struct {
 	database *mongo.Database
 
-	registry *bsoncodec.Registry
+	registry   *bsoncodec.Registry
+	connection *Connection
+	middleware *middleware.Chain
 }
 
 // Collection gets collection from database
@@ -23,9 +26,18 @@ func (d *Database) Collection(name string) *Collection {
 	return &Collection{
 		collection: cp,
 		registry:   d.registry,
+		connection: d.connection,
+		middleware: middleware.NewChain(d.middleware),
 	}
 }
 
+// Middleware returns the middleware chain of this database handle
+// Its middlewares run inside the ones of the connection and wrap every operation of the collections
+// created from this handle afterwards
+func (d *Database) Middleware() *middleware.Chain {
+	return d.middleware
+}
+
 // GetDatabaseName returns the name of database
 func (d *Database) GetDatabaseName() string {
 	return d.database.Name()
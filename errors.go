@@ -4,6 +4,8 @@ import (
 	"errors"
 	"strings"
 
+	"github.com/md-salehzadeh/godm/field"
+	"github.com/md-salehzadeh/godm/validator"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -28,10 +30,35 @@ var (
 	ErrNotSupportedPassword = errors.New("password not supported")
 	// ErrNotValidSliceToInsert return if insert argument is not valid slice
 	ErrNotValidSliceToInsert = errors.New("must be valid slice to insert")
+	// ErrNotInTransaction return if a function which must run inside a transaction is called outside of one
+	ErrNotInTransaction = errors.New("must be called with the context of a transaction")
 	// ErrReplacementContainUpdateOperators return if replacement document contain update operators
 	ErrReplacementContainUpdateOperators = errors.New("replacement document cannot contain keys beginning with '$'")
+	// ErrUpdatePathConflict return if an UpdateBuilder changes a path, or a path and its parent, twice
+	ErrUpdatePathConflict = errors.New("update path used twice")
+	// ErrUpdateEmptyPath return if an UpdateBuilder is given an empty path
+	ErrUpdateEmptyPath = errors.New("update path is empty")
+	// ErrUpdateEmpty return if the document of an UpdateBuilder is used before an operator was added
+	ErrUpdateEmpty = errors.New("update has no operators")
+	// ErrNoFieldsToUpdate return if Collection.UpdateFromStruct finds no field to update
+	ErrNoFieldsToUpdate = errors.New("no fields to update")
+	// ErrBulkWriterClosed return if a BulkWriter is used after Close
+	ErrBulkWriterClosed = errors.New("bulk writer closed")
+	// ErrSyncKeyMissing return if a document of Collection.SyncDocuments lacks one of the key fields
+	ErrSyncKeyMissing = errors.New("sync key field missing")
+	// ErrSyncDuplicateKey return if two documents of Collection.SyncDocuments have the same key
+	ErrSyncDuplicateKey = errors.New("duplicate sync key")
+	// ErrNoActor return if a document requires an actor and the context of the operation has none, see WithActor
+	ErrNoActor = field.ErrNoActor
 )
 
+// ValidationError is returned when a document or an update document fails validation
+// It lists the failures by bson path, use errors.As to get it from the error of an operation
+type ValidationError = validator.ValidationError
+
+// ValidationFailure is one value which failed validation, see ValidationError
+type ValidationFailure = validator.Failure
+
 // IsErrNoDocuments check if err is no documents, both mongo-go-driver error and godm custom error
 // Deprecated, simply call if err == ErrNoSuchDocuments or if err == mongo.ErrNoDocuments
 func IsErrNoDocuments(err error) bool {
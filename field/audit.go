@@ -0,0 +1,150 @@
+package field
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNoActor return if a document requires an actor and the context of the operation has none
+var ErrNoActor = errors.New("no actor in context")
+
+// actorKey is the context key of the actor
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying actor, the user or service which writes documents with it
+// The actor is recorded by the AuditField of the documents
+func WithActor(ctx context.Context, actor interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor
+func ActorFrom(ctx context.Context) (interface{}, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+
+	actor := ctx.Value(actorKey{})
+
+	return actor, actor != nil
+}
+
+// AuditFieldHook defines the interface to record the actors which create and update a document
+type AuditFieldHook interface {
+	AuditCreatedBy(actor interface{}) error
+	AuditUpdatedBy(actor interface{}) error
+}
+
+// ActorRequiredHook defines the interface of documents which can not be written without an actor
+// Operations on them fail with ErrNoActor if their context has none
+type ActorRequiredHook interface {
+	ActorRequired() bool
+}
+
+// AuditField defines the fields recording the actors which create and update a document
+// import the AuditField in document struct to make it working, actors are strings like user names
+// ObjectIDs are stored as hex strings
+type AuditField struct {
+	CreatedBy string `bson:"createdBy"`
+	UpdatedBy string `bson:"updatedBy"`
+}
+
+// AuditCreatedBy changes the createdBy field if it is empty
+func (af *AuditField) AuditCreatedBy(actor interface{}) error {
+	if af.CreatedBy != "" {
+		return nil
+	}
+
+	return setActor(reflect.ValueOf(&af.CreatedBy).Elem(), actor)
+}
+
+// AuditUpdatedBy changes the updatedBy field
+func (af *AuditField) AuditUpdatedBy(actor interface{}) error {
+	return setActor(reflect.ValueOf(&af.UpdatedBy).Elem(), actor)
+}
+
+// AuditFieldOf is AuditField with actors of type T, like primitive.ObjectID for ids of users
+type AuditFieldOf[T any] struct {
+	CreatedBy T `bson:"createdBy"`
+	UpdatedBy T `bson:"updatedBy"`
+}
+
+// AuditCreatedBy changes the createdBy field if it is zero
+func (af *AuditFieldOf[T]) AuditCreatedBy(actor interface{}) error {
+	fv := reflect.ValueOf(&af.CreatedBy).Elem()
+
+	if !fv.IsZero() {
+		return nil
+	}
+
+	return setActor(fv, actor)
+}
+
+// AuditUpdatedBy changes the updatedBy field
+func (af *AuditFieldOf[T]) AuditUpdatedBy(actor interface{}) error {
+	return setActor(reflect.ValueOf(&af.UpdatedBy).Elem(), actor)
+}
+
+// setActor sets the field fv to actor, ObjectIDs are converted to hex strings for string fields
+func setActor(fv reflect.Value, actor interface{}) error {
+	av := reflect.ValueOf(actor)
+
+	switch {
+	case av.Type().AssignableTo(fv.Type()):
+		fv.Set(av)
+	case av.Type() == reflect.TypeOf(primitive.ObjectID{}) && fv.Kind() == reflect.String:
+		fv.SetString(actor.(primitive.ObjectID).Hex())
+	case av.Type().ConvertibleTo(fv.Type()) && av.Kind() == fv.Kind():
+		fv.Set(av.Convert(fv.Type()))
+	default:
+		return fmt.Errorf("can not set actor of type %s to field of type %s", av.Type(), fv.Type())
+	}
+
+	return nil
+}
+
+// requiresActor checks if doc can not be written without an actor
+func requiresActor(doc interface{}) bool {
+	h, ok := doc.(ActorRequiredHook)
+
+	return ok && h.ActorRequired()
+}
+
+// errNoActor returns ErrNoActor for doc
+func errNoActor(doc interface{}) error {
+	return fmt.Errorf("%w: %T requires an actor, see WithActor", ErrNoActor, doc)
+}
+
+// audit records the actor of ctx in doc, in createdBy too if create is set
+func audit(ctx context.Context, doc interface{}, create bool) error {
+	actor, ok := ActorFrom(ctx)
+
+	if !ok {
+		if requiresActor(doc) {
+			return errNoActor(doc)
+		}
+
+		return nil
+	}
+
+	h, ok := doc.(AuditFieldHook)
+
+	if !ok {
+		return nil
+	}
+
+	if create {
+		if err := h.AuditCreatedBy(actor); err != nil {
+			return err
+		}
+	}
+
+	return h.AuditUpdatedBy(actor)
+}
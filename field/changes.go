@@ -0,0 +1,156 @@
+package field
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	marshalerType      = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+	valueMarshalerType = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
+)
+
+// Changes returns the update document of the fields of doc, a struct or a pointer to one, like
+// {"$set": {"name": "Lucas", "address.city": "Paris"}}
+// Without mask every non-zero field is set, the fields of nested structs by their dotted path, and _id is left out.
+// With mask only the fields of its bson paths are set, even if they are zero, and the nil pointers among them are
+// unset. An error wrapping ErrUnknownPath is returned for paths of mask which are not fields of doc
+func Changes(doc interface{}, mask []string) (bson.D, error) {
+	v := reflect.ValueOf(doc)
+
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w, got %T", ErrNotStructPointer, doc)
+	}
+
+	var set, unset bson.D
+
+	if mask == nil {
+		set = changes(set, v, "")
+	}
+
+	for _, path := range mask {
+		if _, err := Resolve(v.Type(), path); err != nil {
+			return nil, err
+		}
+
+		fv, ok := valueAt(v, path)
+
+		if !ok || fv.Kind() == reflect.Ptr && fv.IsNil() {
+			unset = append(unset, bson.E{Key: path, Value: ""})
+		} else {
+			set = append(set, bson.E{Key: path, Value: fv.Interface()})
+		}
+	}
+
+	var update bson.D
+
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+
+	return update, nil
+}
+
+// changes appends the non-zero fields of the struct v, whose bson path is path, to set
+func changes(set bson.D, v reflect.Value, path string) bson.D {
+	for _, f := range StructOf(v.Type()).Fields {
+		if path == "" && f.Key == "_id" {
+			continue
+		}
+
+		fv, err := v.FieldByIndexErr(f.Index)
+
+		if err != nil || fv.IsZero() {
+			continue
+		}
+
+		if nested(fv.Type()) {
+			set = changes(set, reflect.Indirect(fv), join(path, f.Key))
+		} else {
+			set = append(set, bson.E{Key: join(path, f.Key), Value: fv.Interface()})
+		}
+	}
+
+	return set
+}
+
+// nested checks if the fields of the struct type t, or of the struct it points to, are set one by one
+// Structs of the time package and of the driver, and structs marshaling themselves are set as a whole
+func nested(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || t.PkgPath() == "time" || strings.HasPrefix(t.PkgPath(), "go.mongodb.org/mongo-driver/") {
+		return false
+	}
+
+	pt := reflect.PtrTo(t)
+
+	return !pt.Implements(marshalerType) && !pt.Implements(valueMarshalerType)
+}
+
+// valueAt returns the value of the dotted bson path in v, false if a nil pointer, a missing element or a missing
+// key of a map is on the way
+func valueAt(v reflect.Value, path string) (reflect.Value, bool) {
+	for _, segment := range strings.Split(path, ".") {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			f, ok := StructOf(v.Type()).Field(segment)
+
+			if !ok {
+				return reflect.Value{}, false
+			}
+
+			fv, err := v.FieldByIndexErr(f.Index)
+
+			if err != nil {
+				return reflect.Value{}, false
+			}
+
+			v = fv
+		case reflect.Slice, reflect.Array:
+			i, err := strconv.Atoi(segment)
+
+			if err != nil || i < 0 || i >= v.Len() {
+				return reflect.Value{}, false
+			}
+
+			v = v.Index(i)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
+			}
+
+			v = v.MapIndex(reflect.ValueOf(segment).Convert(v.Type().Key()))
+
+			if !v.IsValid() {
+				return reflect.Value{}, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+
+	return v, true
+}
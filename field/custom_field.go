@@ -3,16 +3,16 @@ package field
 import (
 	"fmt"
 	"reflect"
-	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // CustomFields defines struct of supported custom fields
 type CustomFields struct {
-	createAt string
-	updateAt string
-	id       string
+	createAt    string
+	updateAt    string
+	id          string
+	idGenerator IdGenerator
 }
 
 // CustomFieldsHook defines the interface, CustomFields return custom field user want to change
@@ -25,6 +25,7 @@ type CustomFieldsBuilder interface {
 	SetUpdateAt(fieldName string) CustomFieldsBuilder
 	SetCreateAt(fieldName string) CustomFieldsBuilder
 	SetId(fieldName string) CustomFieldsBuilder
+	SetIdGenerator(gen IdGenerator) CustomFieldsBuilder
 }
 
 // NewCustom creates new Builder which is used to set the custom fields
@@ -50,76 +51,65 @@ func (c *CustomFields) SetId(fieldName string) CustomFieldsBuilder {
 	return c
 }
 
+// SetIdGenerator set the generator of the custom Id field, or of the _id field if no custom Id field is set
+func (c *CustomFields) SetIdGenerator(gen IdGenerator) CustomFieldsBuilder {
+	c.idGenerator = gen
+	return c
+}
+
 // CustomCreateTime changes the custom create time
-func (c CustomFields) CustomCreateTime(doc interface{}) {
+// It returns an error if the field is missing or can not hold a time
+func (c CustomFields) CustomCreateTime(doc interface{}) error {
 	if c.createAt == "" {
-		return
+		return nil
 	}
 	fieldName := c.createAt
-	setTime(doc, fieldName, false)
-	return
+	return setTime(doc, fieldName, false)
 }
 
 // CustomUpdateTime changes the custom update time
-func (c CustomFields) CustomUpdateTime(doc interface{}) {
+// It returns an error if the field is missing or can not hold a time
+func (c CustomFields) CustomUpdateTime(doc interface{}) error {
 	if c.updateAt == "" {
-		return
+		return nil
 	}
 	fieldName := c.updateAt
-	setTime(doc, fieldName, true)
-	return
+	return setTime(doc, fieldName, true)
 }
 
-// CustomUpdateTime changes the custom update time
-func (c CustomFields) CustomId(doc interface{}) {
+// CustomId sets the zero custom id to a new ObjectID, or its hex string
+// It returns an error if the field has another type, see SetIdGenerator for other types
+func (c CustomFields) CustomId(doc interface{}) error {
 	if c.id == "" {
-		return
+		return nil
 	}
 	fieldName := c.id
-	setId(doc, fieldName)
-	return
+	return setId(doc, fieldName)
 }
 
 // setTime changes the custom time fields
 // The overWrite defines if change value when the filed has valid value
-func setTime(doc interface{}, fieldName string, overWrite bool) {
-	if reflect.Ptr != reflect.TypeOf(doc).Kind() {
-		fmt.Println("not a point type")
-		return
+// The field is a Go field name or a bson key, see setTimestamp for the supported types
+func setTime(doc interface{}, fieldName string, overWrite bool) error {
+	fv, f, err := customField(doc, fieldName)
+	if err != nil {
+		return err
 	}
-	e := reflect.ValueOf(doc).Elem()
-	ca := e.FieldByName(fieldName)
-	if ca.CanSet() {
-		tt := time.Now()
-		switch a := ca.Interface().(type) {
-		case time.Time:
-			if ca.Interface().(time.Time).IsZero() {
-				ca.Set(reflect.ValueOf(tt))
-			} else if overWrite {
-				ca.Set(reflect.ValueOf(tt))
-			}
-		case int64:
-			if ca.Interface().(int64) == 0 {
-				ca.SetInt(tt.Unix())
-			} else if overWrite {
-				ca.SetInt(tt.Unix())
-			}
-		default:
-			fmt.Println("unsupported type to setTime", a)
-		}
+	if err = setTimestamp(fv, f.Godm.Unit, Now(), overWrite); err != nil {
+		return fmt.Errorf("%s: %w", fieldName, err)
 	}
+	return nil
 }
 
 // setId changes the custom Id fields
-func setId(doc interface{}, fieldName string) {
-	if reflect.Ptr != reflect.TypeOf(doc).Kind() {
-		fmt.Println("not a point type")
-		return
+func setId(doc interface{}, fieldName string) error {
+	v := reflect.ValueOf(doc)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w, got %T", ErrNotStructPointer, doc)
 	}
-	e := reflect.ValueOf(doc).Elem()
-	ca := e.FieldByName(fieldName)
+	ca := v.Elem().FieldByName(fieldName)
 	if ca.CanSet() {
-		switch a := ca.Interface().(type) {
+		switch ca.Interface().(type) {
 		case primitive.ObjectID:
 			if ca.Interface().(primitive.ObjectID).IsZero() {
 				ca.Set(reflect.ValueOf(primitive.NewObjectID()))
@@ -129,7 +119,10 @@ func setId(doc interface{}, fieldName string) {
 				ca.SetString(primitive.NewObjectID().Hex())
 			}
 		default:
-			fmt.Println("unsupported type to setId", a)
+			if ca.IsZero() {
+				return fmt.Errorf("%w: %s of type %s", ErrUnsupportedIdType, fieldName, ca.Type())
+			}
 		}
 	}
+	return nil
 }
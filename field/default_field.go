@@ -1,6 +1,7 @@
 package field
 
 import (
+	"reflect"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -23,13 +24,13 @@ type DefaultField struct {
 
 // DefaultUpdateAt changes the default updateAt field
 func (df *DefaultField) DefaultUpdateAt() {
-	df.UpdateAt = time.Now().Local()
+	df.UpdateAt = Now()
 }
 
 // DefaultCreateAt changes the default createAt field
 func (df *DefaultField) DefaultCreateAt() {
 	if df.CreateAt.IsZero() {
-		df.CreateAt = time.Now().Local()
+		df.CreateAt = Now()
 	}
 }
 
@@ -39,3 +40,38 @@ func (df *DefaultField) DefaultId() {
 		df.Id = primitive.NewObjectID()
 	}
 }
+
+// DefaultFieldOf is DefaultField with an _id of type T, like string for UUIDs or int64 for sequences
+// The id is generated by the IdGenerator of the document, see IdGeneratorHook, ObjectIDs and hex strings are
+// generated otherwise
+type DefaultFieldOf[T any] struct {
+	Id       T         `bson:"_id"`
+	CreateAt time.Time `bson:"createAt"`
+	UpdateAt time.Time `bson:"updateAt"`
+}
+
+// DefaultUpdateAt changes the default updateAt field
+func (df *DefaultFieldOf[T]) DefaultUpdateAt() {
+	df.UpdateAt = Now()
+}
+
+// DefaultCreateAt changes the default createAt field
+func (df *DefaultFieldOf[T]) DefaultCreateAt() {
+	if df.CreateAt.IsZero() {
+		df.CreateAt = Now()
+	}
+}
+
+// DefaultId changes the default _id field if it is an ObjectID or a string
+func (df *DefaultFieldOf[T]) DefaultId() {
+	if !reflect.ValueOf(&df.Id).Elem().IsZero() {
+		return
+	}
+
+	switch id := any(&df.Id).(type) {
+	case *primitive.ObjectID:
+		*id = primitive.NewObjectID()
+	case *string:
+		*id = primitive.NewObjectID().Hex()
+	}
+}
@@ -5,40 +5,96 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/md-salehzadeh/godm/middleware"
 	"github.com/md-salehzadeh/godm/operator"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var nilTime time.Time
 
 // filedHandler defines the relations between field type and handler
-var fieldHandler = map[operator.OpType]func(doc interface{}) error{
+var fieldHandler = map[operator.OpType]func(ctx context.Context, doc interface{}) error{
 	operator.BeforeInsert:  beforeInsert,
 	operator.BeforeUpdate:  beforeUpdate,
-	operator.BeforeReplace: beforeUpdate,
+	operator.BeforeReplace: beforeReplace,
 	operator.BeforeUpsert:  beforeUpsert,
+	operator.BeforeApply:   beforeReplace,
 }
 
 //func init() {
 //	middleware.Register(Do)
 //}
 
+// Handle is the middleware handling the fields of the documents of op before it runs
+// Apply replacing a document is handled like ReplaceOne, or like Upsert when the upsert option is set
+// Updates with operators of a model get its timestamps and the actor of ctx, see Timestamps and Actors
+func Handle(ctx context.Context, op *middleware.Operation, next middleware.Handler) error {
+	doc := op.Documents
+
+	if doc == nil {
+		doc = op.Hook
+	}
+
+	opType := op.Type.Before()
+
+	if op.Type == operator.OpApply && upsert(op.Options) {
+		opType = operator.BeforeUpsert
+	}
+
+	if err := Do(ctx, doc, opType); err != nil {
+		return err
+	}
+
+	if op.Update != nil && op.Model != nil && (op.Type == operator.OpUpdate || op.Type == operator.OpApply) {
+		update, err := Timestamps(ctx, op.Model, op.Update, op.Filter, upsert(op.Options))
+
+		if err != nil {
+			return err
+		}
+
+		if update, err = Actors(ctx, op.Model, update, upsert(op.Options)); err != nil {
+			return err
+		}
+
+		op.Update = update
+	}
+
+	return next(ctx, op)
+}
+
+// upsert checks if the update or findAndModify options have upsert set
+func upsert(opts interface{}) bool {
+	switch o := opts.(type) {
+	case *options.UpdateOptions:
+		return o.Upsert != nil && *o.Upsert
+	case *options.FindOneAndReplaceOptions:
+		return o.Upsert != nil && *o.Upsert
+	case *options.FindOneAndUpdateOptions:
+		return o.Upsert != nil && *o.Upsert
+	}
+	return false
+}
+
 // Do call the specific method to handle field based on fType
 // Don't use opts here
 func Do(ctx context.Context, doc interface{}, opType operator.OpType, opts ...interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	to := reflect.TypeOf(doc)
 	if to == nil {
 		return nil
 	}
 	switch reflect.TypeOf(doc).Kind() {
 	case reflect.Slice:
-		return sliceHandle(doc, opType)
+		return sliceHandle(ctx, doc, opType)
 	case reflect.Ptr:
 		v := reflect.ValueOf(doc).Elem()
 		switch v.Kind() {
 		case reflect.Slice:
-			return sliceHandle(v.Interface(), opType)
+			return sliceHandle(ctx, v.Interface(), opType)
 		default:
-			return do(doc, opType)
+			return do(ctx, doc, opType)
 		}
 	}
 	//fmt.Println("not support type")
@@ -46,11 +102,11 @@ func Do(ctx context.Context, doc interface{}, opType operator.OpType, opts ...in
 }
 
 // sliceHandle handles the slice docs
-func sliceHandle(docs interface{}, opType operator.OpType) error {
+func sliceHandle(ctx context.Context, docs interface{}, opType operator.OpType) error {
 	// []interface{}{UserType{}...}
 	if h, ok := docs.([]interface{}); ok {
 		for _, v := range h {
-			if err := do(v, opType); err != nil {
+			if err := do(ctx, v, opType); err != nil {
 				return err
 			}
 		}
@@ -59,7 +115,7 @@ func sliceHandle(docs interface{}, opType operator.OpType) error {
 	// []UserType{}
 	s := reflect.ValueOf(docs)
 	for i := 0; i < s.Len(); i++ {
-		if err := do(s.Index(i).Interface(), opType); err != nil {
+		if err := do(ctx, s.Index(i).Interface(), opType); err != nil {
 			return err
 		}
 	}
@@ -67,10 +123,16 @@ func sliceHandle(docs interface{}, opType operator.OpType) error {
 }
 
 // beforeInsert handles field before insert
+// The id is generated by the IdGenerator of the document if it has one
+// The actor of ctx is recorded in createdBy and updatedBy, see AuditField
+// The godm tags of the fields are applied, see ApplyTags
 // If value of field createAt is valid in doc, upsert doesn't change it
 // If value of field id is valid in doc, upsert doesn't change it
 // Change the value of field updateAt anyway
-func beforeInsert(doc interface{}) error {
+func beforeInsert(ctx context.Context, doc interface{}) error {
+	if err := generateId(ctx, doc); err != nil {
+		return err
+	}
 	if ih, ok := doc.(DefaultFieldHook); ok {
 		ih.DefaultId()
 		ih.DefaultCreateAt()
@@ -78,30 +140,54 @@ func beforeInsert(doc interface{}) error {
 	}
 	if ih, ok := doc.(CustomFieldsHook); ok {
 		fields := ih.CustomFields()
-		fields.(*CustomFields).CustomId(doc)
-		fields.(*CustomFields).CustomCreateTime(doc)
-		fields.(*CustomFields).CustomUpdateTime(doc)
+		if err := fields.(*CustomFields).CustomId(doc); err != nil {
+			return err
+		}
+		if err := fields.(*CustomFields).CustomCreateTime(doc); err != nil {
+			return err
+		}
+		if err := fields.(*CustomFields).CustomUpdateTime(doc); err != nil {
+			return err
+		}
 	}
-	return nil
+	if err := audit(ctx, doc, true); err != nil {
+		return err
+	}
+	return ApplyTags(doc)
 }
 
 // beforeUpdate handles field before update
-func beforeUpdate(doc interface{}) error {
+// The actor of ctx is recorded in updatedBy, see AuditField
+func beforeUpdate(ctx context.Context, doc interface{}) error {
 	if ih, ok := doc.(DefaultFieldHook); ok {
 		ih.DefaultUpdateAt()
 	}
 	if ih, ok := doc.(CustomFieldsHook); ok {
 		fields := ih.CustomFields()
-		fields.(*CustomFields).CustomUpdateTime(doc)
+		if err := fields.(*CustomFields).CustomUpdateTime(doc); err != nil {
+			return err
+		}
 	}
-	return nil
+	return audit(ctx, doc, false)
+}
+
+// beforeReplace handles field before replace
+// The godm tags of the fields are applied to the replacement
+func beforeReplace(ctx context.Context, doc interface{}) error {
+	if err := beforeUpdate(ctx, doc); err != nil {
+		return err
+	}
+	return ApplyTags(doc)
 }
 
 // beforeUpsert handles field before upsert
 // If value of field createAt is valid in doc, upsert doesn't change it
 // If value of field id is valid in doc, upsert doesn't change it
 // Change the value of field updateAt anyway
-func beforeUpsert(doc interface{}) error {
+func beforeUpsert(ctx context.Context, doc interface{}) error {
+	if err := generateId(ctx, doc); err != nil {
+		return err
+	}
 	if ih, ok := doc.(DefaultFieldHook); ok {
 		ih.DefaultId()
 		ih.DefaultCreateAt()
@@ -109,18 +195,27 @@ func beforeUpsert(doc interface{}) error {
 	}
 	if ih, ok := doc.(CustomFieldsHook); ok {
 		fields := ih.CustomFields()
-		fields.(*CustomFields).CustomId(doc)
-		fields.(*CustomFields).CustomCreateTime(doc)
-		fields.(*CustomFields).CustomUpdateTime(doc)
+		if err := fields.(*CustomFields).CustomId(doc); err != nil {
+			return err
+		}
+		if err := fields.(*CustomFields).CustomCreateTime(doc); err != nil {
+			return err
+		}
+		if err := fields.(*CustomFields).CustomUpdateTime(doc); err != nil {
+			return err
+		}
 	}
-	return nil
+	if err := audit(ctx, doc, true); err != nil {
+		return err
+	}
+	return ApplyTags(doc)
 }
 
 // do check if opType is supported and call fieldHandler
-func do(doc interface{}, opType operator.OpType) error {
+func do(ctx context.Context, doc interface{}, opType operator.OpType) error {
 	if f, ok := fieldHandler[opType]; !ok {
 		return nil
 	} else {
-		return f(doc)
+		return f(ctx, doc)
 	}
 }
@@ -0,0 +1,332 @@
+package field
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IdGenerator generates the ids of new documents
+// Implementations must be safe for concurrent use
+type IdGenerator interface {
+	NewId(ctx context.Context) (interface{}, error)
+}
+
+// IdGeneratorFunc adapts a function to the IdGenerator interface
+type IdGeneratorFunc func(ctx context.Context) (interface{}, error)
+
+// NewId calls f(ctx)
+func (f IdGeneratorFunc) NewId(ctx context.Context) (interface{}, error) {
+	return f(ctx)
+}
+
+// IdGeneratorHook defines the interface of documents which choose the generator of their ids
+type IdGeneratorHook interface {
+	IdGenerator() IdGenerator
+}
+
+// ObjectId generates primitive.ObjectID ids, the default of godm
+func ObjectId() IdGenerator {
+	return IdGeneratorFunc(func(ctx context.Context) (interface{}, error) {
+		return primitive.NewObjectID(), nil
+	})
+}
+
+// UUIDv4 generates random UUIDs as strings, like "1b4e28ba-2fa1-41d2-883f-0016d3cca427"
+func UUIDv4() IdGenerator {
+	return IdGeneratorFunc(func(ctx context.Context) (interface{}, error) {
+		var u [16]byte
+
+		if _, err := rand.Read(u[:]); err != nil {
+			return nil, err
+		}
+
+		u[6] = u[6]&0x0f | 0x40
+		u[8] = u[8]&0x3f | 0x80
+
+		return formatUUID(u), nil
+	})
+}
+
+// UUIDv7 generates time-ordered UUIDs as strings, the first 48 bits are the unix time in milliseconds
+func UUIDv7() IdGenerator {
+	return IdGeneratorFunc(func(ctx context.Context) (interface{}, error) {
+		var u [16]byte
+
+		if _, err := rand.Read(u[6:]); err != nil {
+			return nil, err
+		}
+
+		putMillis(u[:6], time.Now())
+
+		u[6] = u[6]&0x0f | 0x70
+		u[8] = u[8]&0x3f | 0x80
+
+		return formatUUID(u), nil
+	})
+}
+
+// ULID generates time-ordered ULIDs, 26 characters of Crockford's base32 like "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+func ULID() IdGenerator {
+	return IdGeneratorFunc(func(ctx context.Context) (interface{}, error) {
+		var u [16]byte
+
+		if _, err := rand.Read(u[6:]); err != nil {
+			return nil, err
+		}
+
+		putMillis(u[:6], time.Now())
+
+		return encode(u[:], "0123456789ABCDEFGHJKMNPQRSTVWXYZ", 26), nil
+	})
+}
+
+// ksuidEpoch is the epoch of KSUID timestamps, 2014-05-13
+const ksuidEpoch = 1400000000
+
+// KSUID generates KSUID-like ids, 27 base62 characters made of a timestamp in seconds and 128 random bits,
+// which sort by time to the second
+func KSUID() IdGenerator {
+	return IdGeneratorFunc(func(ctx context.Context) (interface{}, error) {
+		var k [20]byte
+
+		if _, err := rand.Read(k[4:]); err != nil {
+			return nil, err
+		}
+
+		binary.BigEndian.PutUint32(k[:4], uint32(time.Now().Unix()-ksuidEpoch))
+
+		return encode(k[:], "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", 27), nil
+	})
+}
+
+// SequenceGenerator generates increasing int64 ids from a counter document {_id: name, seq: n}
+// It reserves blocks of ids with findAndModify $inc, so only one of blockSize ids costs a round trip.
+// Blocks are reserved outside of the transaction of the context, so an aborted or retried transaction does not give
+// its ids again. Sequences have gaps then, like when the process stops before using the ids of its block
+type SequenceGenerator struct {
+	counters  *mongo.Collection
+	name      string
+	blockSize int64
+
+	mu   sync.Mutex
+	next int64
+	last int64
+}
+
+// Sequence creates a SequenceGenerator on the counter name of the collection counters
+// The blockSize is the number of ids reserved at once, 1 if it is less than 1
+func Sequence(counters *mongo.Collection, name string, blockSize int64) *SequenceGenerator {
+	if blockSize < 1 {
+		blockSize = 1
+	}
+
+	return &SequenceGenerator{counters: counters, name: name, blockSize: blockSize}
+}
+
+// NewId returns the next id of the sequence, an int64
+func (s *SequenceGenerator) NewId(ctx context.Context) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next == 0 || s.next > s.last {
+		if err := s.reserve(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	id := s.next
+
+	s.next++
+
+	return id, nil
+}
+
+// reserve reserves the next block of ids
+// The counter is incremented without the session of ctx, only its deadline applies
+func (s *SequenceGenerator) reserve(ctx context.Context) error {
+	rctx := context.Background()
+
+	if ctx != nil {
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+
+			rctx, cancel = context.WithDeadline(rctx, deadline)
+
+			defer cancel()
+		}
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+
+	err := s.counters.FindOneAndUpdate(rctx, bson.M{"_id": s.name}, bson.M{"$inc": bson.M{"seq": s.blockSize}}, opts).Decode(&counter)
+
+	if err != nil {
+		return err
+	}
+
+	s.next, s.last = counter.Seq-s.blockSize+1, counter.Seq
+
+	return nil
+}
+
+// idGeneratorOf returns the generator doc chose, by CustomFields.SetIdGenerator first, then by IdGeneratorHook, and the
+// custom id field of doc
+func idGeneratorOf(doc interface{}) (IdGenerator, string) {
+	var (
+		gen       IdGenerator
+		fieldName string
+	)
+
+	if h, ok := doc.(CustomFieldsHook); ok {
+		if fields, ok := h.CustomFields().(*CustomFields); ok {
+			gen, fieldName = fields.idGenerator, fields.id
+		}
+	}
+
+	if h, ok := doc.(IdGeneratorHook); ok && gen == nil {
+		gen = h.IdGenerator()
+	}
+
+	return gen, fieldName
+}
+
+// generateId sets the id of doc with the generator the document chose, by IdGeneratorHook or by
+// CustomFields.SetIdGenerator, if the id is zero
+// The id field is the custom id field, or the field with the bson key _id
+func generateId(ctx context.Context, doc interface{}) error {
+	gen, fieldName := idGeneratorOf(doc)
+
+	if gen == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(doc)
+
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	id, err := idField(v.Elem(), fieldName)
+
+	if err != nil || !id.IsZero() {
+		return err
+	}
+
+	newId, err := gen.NewId(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return assignId(id, newId)
+}
+
+// idField returns the field fieldName of v, or the field with the bson key _id if fieldName is empty
+func idField(v reflect.Value, fieldName string) (reflect.Value, error) {
+	if fieldName != "" {
+		id := v.FieldByName(fieldName)
+
+		if !id.CanSet() {
+			return reflect.Value{}, fmt.Errorf("no settable id field %s in %s", fieldName, v.Type())
+		}
+
+		return id, nil
+	}
+
+	f, ok := StructOf(v.Type()).Field("_id")
+
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("no _id field in %s", v.Type())
+	}
+
+	return v.FieldByIndexErr(f.Index)
+}
+
+// assignId sets the field id to newId, numbers are converted to the type of the field
+func assignId(id reflect.Value, newId interface{}) error {
+	nv := reflect.ValueOf(newId)
+
+	switch {
+	case nv.Type().AssignableTo(id.Type()):
+		id.Set(nv)
+	case numeric(nv.Kind()) && numeric(id.Kind()):
+		id.Set(nv.Convert(id.Type()))
+	case nv.Type() == reflect.TypeOf(primitive.ObjectID{}) && id.Kind() == reflect.String:
+		id.SetString(newId.(primitive.ObjectID).Hex())
+	default:
+		return fmt.Errorf("can not set id of type %s to field of type %s", nv.Type(), id.Type())
+	}
+
+	return nil
+}
+
+// numeric checks if k is an integer kind
+func numeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// formatUUID formats u in the canonical 8-4-4-4-12 form
+func formatUUID(u [16]byte) string {
+	var b [36]byte
+
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+
+	return string(b[:])
+}
+
+// putMillis writes the unix time of t in milliseconds as 48 bits big endian
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixMilli())
+
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+// encode encodes the big endian number b in the digits of alphabet, padded to width
+func encode(b []byte, alphabet string, width int) string {
+	n := new(big.Int).SetBytes(b)
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+
+	out := make([]byte, width)
+
+	for i := width - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+
+		out[i] = alphabet[mod.Int64()]
+	}
+
+	return string(out)
+}
@@ -0,0 +1,269 @@
+package field
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownPath return if a bson path does not lead to a field of the struct
+var ErrUnknownPath = errors.New("unknown bson path")
+
+// Struct describes the bson fields of a struct type
+type Struct struct {
+	Type   reflect.Type
+	Fields []*Field
+
+	keys map[string]*Field
+}
+
+// Field describes one bson field of a struct, fields of inline structs are promoted to the outer struct
+type Field struct {
+	Name      string            // name of the Go field
+	Key       string            // bson key of the field
+	Index     []int             // index sequence for reflect.Value.FieldByIndex
+	Type      reflect.Type      // type of the field
+	Tag       reflect.StructTag // tag of the field
+	OmitEmpty bool              // the bson tag has omitempty
+	Godm      Tag               // the parsed godm tag
+}
+
+// structs caches the Struct of every type, like the official driver does for its codecs
+var structs sync.Map
+
+// StructOf returns the bson fields of t, pointers are dereferenced
+// It returns nil if t is not a struct
+func StructOf(t reflect.Type) *Struct {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if s, ok := structs.Load(t); ok {
+		return s.(*Struct)
+	}
+
+	s := &Struct{Type: t, keys: make(map[string]*Field)}
+
+	s.collect(t, nil)
+
+	for _, f := range s.Fields {
+		s.keys[f.Key] = f
+	}
+
+	actual, _ := structs.LoadOrStore(t, s)
+
+	return actual.(*Struct)
+}
+
+// collect adds the fields of t to s, index is the index sequence of t in the outer struct
+func (s *Struct) collect(t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		key, opts := parseTag(sf)
+
+		if key == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if opts["inline"] {
+			ft := sf.Type
+
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				s.collect(ft, fieldIndex)
+
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		s.Fields = append(s.Fields, &Field{
+			Name:      sf.Name,
+			Key:       key,
+			Index:     fieldIndex,
+			Type:      sf.Type,
+			Tag:       sf.Tag,
+			OmitEmpty: opts["omitempty"],
+			Godm:      parseGodmTag(sf.Tag.Get("godm")),
+		})
+	}
+}
+
+// parseTag returns the bson key and the options of a struct field, following the official driver
+// The key is the lowercased field name if the tag has none
+func parseTag(sf reflect.StructField) (string, map[string]bool) {
+	tag, ok := sf.Tag.Lookup("bson")
+
+	if !ok && !strings.Contains(string(sf.Tag), ":") && len(sf.Tag) > 0 {
+		tag = string(sf.Tag)
+	}
+
+	parts := strings.Split(tag, ",")
+
+	key := parts[0]
+
+	if key == "" {
+		key = strings.ToLower(sf.Name)
+	}
+
+	opts := make(map[string]bool, len(parts)-1)
+
+	for _, opt := range parts[1:] {
+		opts[opt] = true
+	}
+
+	return key, opts
+}
+
+// Field returns the field of bson key
+func (s *Struct) Field(key string) (*Field, bool) {
+	f, ok := s.keys[key]
+
+	return f, ok
+}
+
+// Resolved is the end of a bson path in a struct
+type Resolved struct {
+	Field *Field       // the last struct field of the path
+	Type  reflect.Type // the type at the end of the path
+	Elem  int          // number of array elements or map values entered after Field
+}
+
+// Resolve follows a dotted bson path, like "address.city" or "items.$[].qty", from the struct type t
+// Array indexes and the positional operators "$", "$[]" and "$[<identifier>]" enter the elements of arrays,
+// any key enters the values of maps
+// An error wrapping ErrUnknownPath is returned if the path leaves the struct
+func Resolve(t reflect.Type, path string) (*Resolved, error) {
+	r := &Resolved{Type: t}
+
+	for _, segment := range strings.Split(path, ".") {
+		for r.Type.Kind() == reflect.Ptr {
+			r.Type = r.Type.Elem()
+		}
+
+		switch r.Type.Kind() {
+		case reflect.Slice, reflect.Array:
+			if r.Type.Elem().Kind() == reflect.Uint8 || !positional(segment) {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownPath, path)
+			}
+
+			r.Type = r.Type.Elem()
+			r.Elem++
+		case reflect.Map:
+			r.Type = r.Type.Elem()
+			r.Elem++
+		case reflect.Struct:
+			s := StructOf(r.Type)
+
+			f, ok := s.Field(segment)
+
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownPath, path)
+			}
+
+			r.Field = f
+			r.Type = f.Type
+			r.Elem = 0
+		case reflect.Interface:
+			// anything goes below an interface{}
+			return r, nil
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPath, path)
+		}
+	}
+
+	return r, nil
+}
+
+// positional checks if segment addresses elements of an array
+func positional(segment string) bool {
+	if segment == "$" || strings.HasPrefix(segment, "$[") && strings.HasSuffix(segment, "]") {
+		return true
+	}
+
+	_, err := strconv.Atoi(segment)
+
+	return err == nil
+}
+
+// BsonPath translates a path of Go field names from the struct type t, like "Items[0].City" in the namespaces of
+// go-playground/validator, into a dotted bson path, like "items.0.city"
+// A namespace starting with an index, like "[2]", starts in the elements of t.
+// Inline structs add no segment to the bson path, segments which are not fields of t are kept as they are
+func BsonPath(t reflect.Type, namespace string) string {
+	var path []string
+
+	for _, segment := range strings.Split(namespace, ".") {
+		name, indexes := segment, []string(nil)
+
+		if i := strings.IndexByte(segment, '['); i >= 0 {
+			name = segment[:i]
+			indexes = strings.Split(strings.TrimSuffix(segment[i+1:], "]"), "][")
+		}
+
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if name != "" {
+			var sf reflect.StructField
+
+			ok := t != nil && t.Kind() == reflect.Struct
+
+			if ok {
+				sf, ok = t.FieldByName(name)
+			}
+
+			if !ok {
+				path = append(path, segment)
+				t = nil
+
+				continue
+			}
+
+			key, opts := parseTag(sf)
+
+			t = sf.Type
+
+			if !opts["inline"] {
+				path = append(path, key)
+			}
+		}
+
+		for _, index := range indexes {
+			path = append(path, index)
+
+			for t != nil && t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+
+			if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+				t = t.Elem()
+			} else {
+				t = nil
+			}
+		}
+	}
+
+	return strings.Join(path, ".")
+}
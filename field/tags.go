@@ -0,0 +1,386 @@
+package field
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tag is the parsed godm tag of a field, like `godm:"default=pending"`, `godm:"trim,lowercase"` or `godm:"slug=Title"`
+type Tag struct {
+	Default    string // value set when the field is zero, "now" sets time fields to the current time
+	HasDefault bool   // the tag has a default
+	Trim       bool   // trim the spaces around strings
+	Lowercase  bool   // lowercase strings
+	Uppercase  bool   // uppercase strings
+	Slug       string // name of the Go or bson field the slug is made of when the field is empty
+	Unit       string // unit of integer timestamps, like UnitMilliseconds
+}
+
+// empty checks if t has no option
+func (t Tag) empty() bool {
+	return t == Tag{}
+}
+
+// parseGodmTag parses the options of a godm tag
+func parseGodmTag(tag string) Tag {
+	var t Tag
+
+	for _, opt := range strings.Split(tag, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+
+		switch name {
+		case "default":
+			t.Default, t.HasDefault = value, true
+		case "trim":
+			t.Trim = true
+		case "lowercase":
+			t.Lowercase = true
+		case "uppercase":
+			t.Uppercase = true
+		case "slug":
+			t.Slug = value
+		case "unit":
+			t.Unit = value
+		}
+	}
+
+	return t
+}
+
+// tagged caches if a type has fields with godm tags, itself or in nested structs, pointers and slices
+var (
+	taggedMu sync.Mutex
+	tagged   = make(map[reflect.Type]bool)
+)
+
+// hasTags checks if t or the types it nests have fields with godm tags
+func hasTags(t reflect.Type) bool {
+	taggedMu.Lock()
+	defer taggedMu.Unlock()
+
+	if has, ok := tagged[t]; ok {
+		return has
+	}
+
+	has := nestsTags(t, make(map[reflect.Type]bool))
+
+	tagged[t] = has
+
+	return has
+}
+
+// nestsTags checks if t or the types it nests have fields with godm tags, visiting holds the types being checked
+// so recursive types end
+func nestsTags(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if has, ok := tagged[t]; ok {
+		return has
+	}
+
+	if visiting[t] {
+		return false
+	}
+
+	visiting[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return nestsTags(t.Elem(), visiting)
+	case reflect.Struct:
+		if s := StructOf(t); s != nil {
+			for _, f := range s.Fields {
+				if !f.Godm.empty() || nestsTags(f.Type, visiting) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// ApplyTags applies the godm tags of the fields of doc, which must be a pointer to a struct
+// Tags of nested structs, pointers to structs and slices of structs are applied too
+func ApplyTags(doc interface{}) error {
+	v := reflect.ValueOf(doc)
+
+	if v.Kind() != reflect.Ptr || v.IsNil() || !hasTags(v.Type()) {
+		return nil
+	}
+
+	return applyTags(v.Elem(), "")
+}
+
+// applyTags applies the godm tags of the fields of v, path is the bson path of v for errors
+func applyTags(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		return applyTags(v.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		if !hasTags(v.Type().Elem()) {
+			return nil
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			if err := applyTags(v.Index(i), join(path, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		s := StructOf(v.Type())
+
+		if s == nil || !v.CanSet() || !hasTags(v.Type()) {
+			return nil
+		}
+
+		for _, f := range s.Fields {
+			fv, err := v.FieldByIndexErr(f.Index)
+
+			if err != nil {
+				continue
+			}
+
+			if !f.Godm.empty() {
+				if err := applyTag(v, fv, f); err != nil {
+					return fmt.Errorf("godm tag of %s: %w", join(path, f.Key), err)
+				}
+			}
+
+			if err := applyTags(fv, join(path, f.Key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyTag applies the godm tag of the field f of the struct v, fv is the value of f
+func applyTag(v reflect.Value, fv reflect.Value, f *Field) error {
+	t := f.Godm
+
+	if t.Slug != "" && fv.IsZero() {
+		source, ok := sourceField(v, t.Slug)
+
+		if !ok {
+			return fmt.Errorf("no field %s to make the slug of", t.Slug)
+		}
+
+		if slug := Slugify(source); slug != "" {
+			if err := setString(fv, slug); err != nil {
+				return err
+			}
+		}
+	}
+
+	if t.HasDefault && fv.IsZero() {
+		if err := setDefault(fv, t.Default, t.Unit); err != nil {
+			return err
+		}
+	}
+
+	if t.Trim || t.Lowercase || t.Uppercase {
+		return normalize(fv, t)
+	}
+
+	return nil
+}
+
+// sourceField returns the string the slug is made of, name is a Go field name or a bson key of v
+func sourceField(v reflect.Value, name string) (string, bool) {
+	s := StructOf(v.Type())
+
+	var src *Field
+
+	for _, f := range s.Fields {
+		if f.Name == name {
+			src = f
+
+			break
+		}
+	}
+
+	if src == nil {
+		if src, _ = s.Field(name); src == nil {
+			return "", false
+		}
+	}
+
+	fv, err := v.FieldByIndexErr(src.Index)
+
+	if err != nil {
+		return "", true
+	}
+
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return "", true
+		}
+
+		fv = fv.Elem()
+	}
+
+	if fv.Kind() != reflect.String {
+		return "", false
+	}
+
+	return fv.String(), true
+}
+
+// Slugify makes a lowercase slug of s, like "hello-world" of "Hello, World!"
+// Letters and digits are kept, every other run of characters becomes a single dash
+func Slugify(s string) string {
+	var b strings.Builder
+
+	dash := false
+
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+
+			b.WriteRune(r)
+
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
+// normalize trims and changes the case of the string fv points to
+func normalize(fv reflect.Value, t Tag) error {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+
+		fv = fv.Elem()
+	}
+
+	if fv.Kind() != reflect.String {
+		return fmt.Errorf("trim, lowercase and uppercase only apply to strings, not %s", fv.Type())
+	}
+
+	s := fv.String()
+
+	if t.Trim {
+		s = strings.TrimSpace(s)
+	}
+
+	if t.Lowercase {
+		s = strings.ToLower(s)
+	}
+
+	if t.Uppercase {
+		s = strings.ToUpper(s)
+	}
+
+	fv.SetString(s)
+
+	return nil
+}
+
+// setString sets the string fv points to, pointers are allocated
+func setString(fv reflect.Value, s string) error {
+	fv = alloc(fv)
+
+	if fv.Kind() != reflect.String {
+		return fmt.Errorf("slug only applies to strings, not %s", fv.Type())
+	}
+
+	fv.SetString(s)
+
+	return nil
+}
+
+// setDefault parses value into the type of fv and sets it, pointers are allocated
+// The value "now" sets a timestamp in unit, see setTimestamp
+func setDefault(fv reflect.Value, value string, unit string) error {
+	if value == "now" {
+		return setTimestamp(fv, unit, Now(), true)
+	}
+
+	fv = alloc(fv)
+
+	switch fv.Interface().(type) {
+	case time.Time, primitive.DateTime:
+		return fmt.Errorf("the default of time fields must be now, not %q", value)
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("default is not supported for %s", fv.Type())
+	}
+
+	return nil
+}
+
+// alloc allocates the nil pointers of fv and returns the value they point to
+func alloc(fv reflect.Value) reflect.Value {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+
+		fv = fv.Elem()
+	}
+
+	return fv
+}
+
+// join joins a bson path and a key
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
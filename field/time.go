@@ -0,0 +1,211 @@
+package field
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotStructPointer return if the document to handle is not a pointer to a struct
+	ErrNotStructPointer = errors.New("document must be a pointer to a struct")
+	// ErrFieldNotFound return if a custom field is not a settable field of the document
+	ErrFieldNotFound = errors.New("field not found in document")
+	// ErrUnsupportedTimeType return if a timestamp field has a type which can not hold a time
+	ErrUnsupportedTimeType = errors.New("unsupported type of timestamp field")
+	// ErrUnsupportedIdType return if a zero custom id field is neither an ObjectID nor a string and has no id generator
+	ErrUnsupportedIdType = errors.New("unsupported type of id field")
+)
+
+// TimePolicy defines the timestamps set by the field package and returned by godm.Now
+type TimePolicy struct {
+	// Clock returns the current time, the default is time.Now. Set it to a fixed clock in tests.
+	Clock func() time.Time
+	// UTC sets timestamps in UTC instead of the local time zone
+	UTC bool
+	// Precision truncates timestamps, the default is time.Millisecond as MongoDB stores dates in milliseconds,
+	// a negative value keeps the precision of the clock
+	Precision time.Duration
+	// CurrentDate sets the update time of updates with operators by $currentDate, the time of the server,
+	// instead of $set, for fields stored as dates
+	CurrentDate bool
+}
+
+// policy holds the current TimePolicy
+var policy atomic.Value
+
+func init() {
+	policy.Store(TimePolicy{Clock: time.Now, Precision: time.Millisecond})
+}
+
+// SetTimePolicy sets the policy of the timestamps of every document, unset fields take their default
+func SetTimePolicy(p TimePolicy) {
+	if p.Clock == nil {
+		p.Clock = time.Now
+	}
+
+	if p.Precision == 0 {
+		p.Precision = time.Millisecond
+	}
+
+	policy.Store(p)
+}
+
+// Now returns the current time according to the TimePolicy
+func Now() time.Time {
+	p := policy.Load().(TimePolicy)
+
+	t := p.Clock()
+
+	if p.Precision > 0 {
+		t = time.Unix(0, t.UnixNano()/int64(p.Precision)*int64(p.Precision))
+	}
+
+	if p.UTC {
+		return t.UTC()
+	}
+
+	return t.Local()
+}
+
+// define the units of integer timestamps, set by the godm tag like `godm:"unit=ms"`, the default is seconds
+const (
+	UnitSeconds      = "s"
+	UnitMilliseconds = "ms"
+	UnitMicroseconds = "us"
+	UnitNanoseconds  = "ns"
+)
+
+// setTimestamp sets the timestamp field fv to now if it is zero or overWrite is set
+// It supports time.Time, primitive.DateTime, integers in unit and pointers to them, nil pointers are allocated
+func setTimestamp(fv reflect.Value, unit string, now time.Time, overWrite bool) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+
+			overWrite = true
+		}
+
+		return setTimestamp(fv.Elem(), unit, now, overWrite)
+	}
+
+	if !fv.IsZero() && !overWrite {
+		return nil
+	}
+
+	switch fv.Interface().(type) {
+	case time.Time:
+		fv.Set(reflect.ValueOf(now))
+
+		return nil
+	case primitive.DateTime:
+		fv.Set(reflect.ValueOf(primitive.NewDateTimeFromTime(now)))
+
+		return nil
+	}
+
+	var n int64
+
+	switch unit {
+	case "", UnitSeconds:
+		n = now.Unix()
+	case UnitMilliseconds:
+		n = now.UnixMilli()
+	case UnitMicroseconds:
+		n = now.UnixMicro()
+	case UnitNanoseconds:
+		n = now.UnixNano()
+	default:
+		return fmt.Errorf("unknown unit %q of timestamp", unit)
+	}
+
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if fv.OverflowInt(n) {
+			return fmt.Errorf("%w: %s overflows with unit %q", ErrUnsupportedTimeType, fv.Type(), unit)
+		}
+
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		if n < 0 || fv.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%w: %s overflows with unit %q", ErrUnsupportedTimeType, fv.Type(), unit)
+		}
+
+		fv.SetUint(uint64(n))
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedTimeType, fv.Type())
+	}
+
+	return nil
+}
+
+// customField returns the field of doc named fieldName, a Go field name or a bson key
+// Fields of embedded and inline structs are found too, like reflect.Value.FieldByName does, nil embedded pointers
+// are allocated
+func customField(doc interface{}, fieldName string) (reflect.Value, *Field, error) {
+	v := reflect.ValueOf(doc)
+
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, nil, fmt.Errorf("%w, got %T", ErrNotStructPointer, doc)
+	}
+
+	v = v.Elem()
+
+	s := StructOf(v.Type())
+
+	var f *Field
+
+	for _, sf := range s.Fields {
+		if sf.Name == fieldName {
+			f = sf
+
+			break
+		}
+	}
+
+	if f == nil {
+		f, _ = s.Field(fieldName)
+	}
+
+	if f == nil {
+		// a field the bson fields miss, like one of an anonymous embedded struct without inline
+		if sf, ok := v.Type().FieldByName(fieldName); ok {
+			f = &Field{
+				Name:  sf.Name,
+				Key:   sf.Name,
+				Index: sf.Index,
+				Type:  sf.Type,
+				Tag:   sf.Tag,
+				Godm:  parseGodmTag(sf.Tag.Get("godm")),
+			}
+		}
+	}
+
+	if f == nil {
+		return reflect.Value{}, nil, fmt.Errorf("%w: %s in %s", ErrFieldNotFound, fieldName, v.Type())
+	}
+
+	fv := v
+
+	for _, i := range f.Index {
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+
+			fv = fv.Elem()
+		}
+
+		fv = fv.Field(i)
+	}
+
+	if !fv.CanSet() {
+		return reflect.Value{}, nil, fmt.Errorf("%w: %s in %s", ErrFieldNotFound, fieldName, v.Type())
+	}
+
+	return fv, f, nil
+}
@@ -0,0 +1,351 @@
+package field
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Timestamps adds the timestamps of model to an update document with operators
+// The update time field is set with $set, or with $currentDate if TimePolicy.CurrentDate is set. On upserts the
+// creation time and the id are set with $setOnInsert, the id only if the filter has no _id.
+// The fields are the ones of DefaultField or of the CustomFields of model. Paths the update already sets are left
+// alone, pipelines and replacement documents are returned as they are
+func Timestamps(ctx context.Context, model interface{}, update interface{}, filter interface{}, upsert bool) (interface{}, error) {
+	id, createAt, updateAt := timestampFields(model)
+
+	if updateAt == nil && (!upsert || createAt == nil && id == nil) {
+		return update, nil
+	}
+
+	doc, ok := operatorDocument(update)
+
+	if !ok {
+		return update, nil
+	}
+
+	used := usedPaths(doc)
+
+	now := Now()
+
+	p := policy.Load().(TimePolicy)
+
+	if updateAt != nil && !used.conflicts(updateAt.Key) {
+		if p.CurrentDate && isDate(updateAt.Type) {
+			doc = setOperator(doc, "$currentDate", updateAt.Key, true)
+		} else {
+			v, err := timestampValue(updateAt, now)
+
+			if err != nil {
+				return nil, err
+			}
+
+			doc = setOperator(doc, "$set", updateAt.Key, v)
+		}
+	}
+
+	if !upsert {
+		return doc, nil
+	}
+
+	if createAt != nil && !used.conflicts(createAt.Key) {
+		v, err := timestampValue(createAt, now)
+
+		if err != nil {
+			return nil, err
+		}
+
+		doc = setOperator(doc, "$setOnInsert", createAt.Key, v)
+	}
+
+	if id != nil && !used.conflicts(id.Key) && !hasId(filter) {
+		v, err := newIdValue(ctx, model, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if v != nil {
+			doc = setOperator(doc, "$setOnInsert", id.Key, v)
+		}
+	}
+
+	return doc, nil
+}
+
+// Actors adds the actor of ctx to an update document with operators of model, see AuditField
+// The updatedBy field is set with $set, and on upserts the createdBy field with $setOnInsert. It returns ErrNoActor
+// if model requires an actor and ctx has none
+func Actors(ctx context.Context, model interface{}, update interface{}, upsert bool) (interface{}, error) {
+	actor, ok := ActorFrom(ctx)
+
+	if !ok {
+		if requiresActor(model) {
+			return nil, errNoActor(model)
+		}
+
+		return update, nil
+	}
+
+	s := StructOf(reflect.TypeOf(model))
+
+	if _, ok := model.(AuditFieldHook); !ok || s == nil {
+		return update, nil
+	}
+
+	doc, ok := operatorDocument(update)
+
+	if !ok {
+		return update, nil
+	}
+
+	used := usedPaths(doc)
+
+	doc, err := setActorField(doc, used, s.lookup("updatedBy"), "$set", actor)
+
+	if err != nil || !upsert {
+		return doc, err
+	}
+
+	return setActorField(doc, used, s.lookup("createdBy"), "$setOnInsert", actor)
+}
+
+// setActorField sets the actor field f to actor in the operator op of doc, unless doc already sets it
+func setActorField(doc bson.D, used paths, f *Field, op string, actor interface{}) (bson.D, error) {
+	if f == nil || used.conflicts(f.Key) {
+		return doc, nil
+	}
+
+	v := reflect.New(f.Type).Elem()
+
+	if err := setActor(v, actor); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Key, err)
+	}
+
+	return setOperator(doc, op, f.Key, v.Interface()), nil
+}
+
+// timestampFields returns the fields of model holding the id, the creation time and the update time,
+// from its CustomFields or from DefaultField, nil for the fields it does not have
+func timestampFields(model interface{}) (id, createAt, updateAt *Field) {
+	s := StructOf(reflect.TypeOf(model))
+
+	if s == nil {
+		return
+	}
+
+	if h, ok := model.(CustomFieldsHook); ok {
+		if fields, ok := h.CustomFields().(*CustomFields); ok {
+			return s.lookup(fields.id), s.lookup(fields.createAt), s.lookup(fields.updateAt)
+		}
+	}
+
+	if _, ok := model.(DefaultFieldHook); ok {
+		return s.lookup("_id"), s.lookup("createAt"), s.lookup("updateAt")
+	}
+
+	return
+}
+
+// InsertOnly returns the fields of model which are set when its documents are inserted and kept by later writes:
+// the id, the creation time and the createdBy field of AuditField
+func InsertOnly(model interface{}) []*Field {
+	s := StructOf(reflect.TypeOf(model))
+
+	if s == nil {
+		return nil
+	}
+
+	id, createAt, _ := timestampFields(model)
+
+	if id == nil {
+		id = s.lookup("_id")
+	}
+
+	fields := []*Field{id, createAt}
+
+	if _, ok := model.(AuditFieldHook); ok {
+		fields = append(fields, s.lookup("createdBy"))
+	}
+
+	var insertOnly []*Field
+
+	for _, f := range fields {
+		if f != nil {
+			insertOnly = append(insertOnly, f)
+		}
+	}
+
+	return insertOnly
+}
+
+// lookup returns the field with the Go name or the bson key name, nil if there is none
+func (s *Struct) lookup(name string) *Field {
+	if name == "" {
+		return nil
+	}
+
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	f, _ := s.Field(name)
+
+	return f
+}
+
+// operatorDocument converts an update document with operators to a bson.D
+func operatorDocument(update interface{}) (bson.D, bool) {
+	if update == nil {
+		return nil, false
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(update)).Kind() {
+	case reflect.Slice, reflect.Array:
+		if _, ok := update.(bson.D); !ok {
+			return nil, false
+		}
+	}
+
+	b, err := bson.Marshal(update)
+
+	if err != nil {
+		return nil, false
+	}
+
+	var doc bson.D
+
+	if err = bson.Unmarshal(b, &doc); err != nil || len(doc) == 0 {
+		return nil, false
+	}
+
+	for _, e := range doc {
+		if !strings.HasPrefix(e.Key, "$") {
+			return nil, false
+		}
+	}
+
+	return doc, true
+}
+
+// paths is the set of the paths an update document changes
+type paths []string
+
+// usedPaths returns the paths the operators of doc change
+func usedPaths(doc bson.D) paths {
+	var used paths
+
+	for _, e := range doc {
+		switch v := e.Value.(type) {
+		case bson.D:
+			for _, f := range v {
+				used = append(used, f.Key)
+			}
+		case bson.M:
+			for k := range v {
+				used = append(used, k)
+			}
+		}
+	}
+
+	return used
+}
+
+// conflicts checks if setting path conflicts with a used path, the same path or one of its parents or children
+func (used paths) conflicts(path string) bool {
+	for _, p := range used {
+		if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setOperator sets key to value in the operator op of doc, adding the operator if needed
+func setOperator(doc bson.D, op string, key string, value interface{}) bson.D {
+	for i, e := range doc {
+		if e.Key != op {
+			continue
+		}
+
+		switch v := e.Value.(type) {
+		case bson.D:
+			doc[i].Value = append(v, bson.E{Key: key, Value: value})
+		case bson.M:
+			v[key] = value
+		}
+
+		return doc
+	}
+
+	return append(doc, bson.E{Key: op, Value: bson.D{{Key: key, Value: value}}})
+}
+
+// hasId checks if filter matches a given _id, then upserts insert the document with it
+func hasId(filter interface{}) bool {
+	b, err := bson.Marshal(filter)
+
+	if err != nil {
+		return false
+	}
+
+	_, err = bson.Raw(b).LookupErr("_id")
+
+	return err == nil
+}
+
+// isDate checks if values of t are stored as dates
+func isDate(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t == reflect.TypeOf(time.Time{}) || t == reflect.TypeOf(primitive.DateTime(0))
+}
+
+// timestampValue returns now as a value of the type of the timestamp field f
+func timestampValue(f *Field, now time.Time) (interface{}, error) {
+	v := reflect.New(f.Type).Elem()
+
+	if err := setTimestamp(v, f.Godm.Unit, now, true); err != nil {
+		return nil, err
+	}
+
+	return v.Interface(), nil
+}
+
+// newIdValue generates an id of the type of the id field f with the generator of model, see generateId
+// It returns nil if model has no generator and f can take neither an ObjectID nor its hex string
+func newIdValue(ctx context.Context, model interface{}, f *Field) (interface{}, error) {
+	gen, _ := idGeneratorOf(model)
+
+	if gen == nil {
+		if !reflect.TypeOf(primitive.ObjectID{}).AssignableTo(f.Type) && f.Type.Kind() != reflect.String {
+			return nil, nil
+		}
+
+		gen = ObjectId()
+	}
+
+	newId, err := gen.NewId(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.New(f.Type).Elem()
+
+	if err = assignId(v, newId); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Key, err)
+	}
+
+	return v.Interface(), nil
+}
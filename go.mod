@@ -3,6 +3,7 @@ module github.com/md-salehzadeh/godm
 go 1.18
 
 require (
+	github.com/go-playground/universal-translator v0.17.0
 	github.com/go-playground/validator/v10 v10.4.1
 	github.com/k0kubun/pp/v3 v3.1.0
 	go.mongodb.org/mongo-driver v1.9.0
@@ -10,7 +11,6 @@ require (
 
 require (
 	github.com/go-playground/locales v0.13.0 // indirect
-	github.com/go-playground/universal-translator v0.17.0 // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/golang/snappy v0.0.1 // indirect
 	github.com/klauspost/compress v1.13.6 // indirect
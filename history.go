@@ -0,0 +1,361 @@
+package godm
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/md-salehzadeh/godm/field"
+	"github.com/md-salehzadeh/godm/middleware"
+	"github.com/md-salehzadeh/godm/operator"
+	gOpts "github.com/md-salehzadeh/godm/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// HistoryHook defines the interface of models which keep the prior versions of their documents
+// Before every replace, update, Apply and remove of the collection of the model, the documents it changes are copied
+// to the history collection, see Collection.HistoryCollection. The operations of a Bulk are recorded when it runs
+type HistoryHook interface {
+	History() bool
+}
+
+// CurrentRevision stands for the current version of a document in Collection.DiffRevisions
+const CurrentRevision int64 = 0
+
+// define the kinds of the differences between two versions of a document
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// Revision is a prior version of a document, stored in the history collection of its collection
+type Revision struct {
+	Id         primitive.ObjectID `bson:"_id"`
+	DocumentId interface{}        `bson:"documentId"`
+	Revision   int64              `bson:"revision"` // 1 for the first version of the document
+	Op         operator.OpType    `bson:"op"`       // the operation which changed the version, like operator.OpUpdate
+	Actor      interface{}        `bson:"actor,omitempty"`
+	CreateAt   time.Time          `bson:"createAt"`
+	Document   bson.Raw           `bson:"document"`
+}
+
+// RevisionDiff is a difference between two versions of a document
+// Embedded documents are compared field by field, arrays as a whole
+type RevisionDiff struct {
+	Path string      // bson path of the field, like "address.city"
+	Kind string      // DiffAdded, DiffRemoved or DiffChanged
+	From interface{} // value in the older version, nil if the field was added
+	To   interface{} // value in the newer version, nil if the field was removed
+}
+
+// historyName returns the name of the history collection of the collection coll
+func historyName(coll string) string {
+	return coll + "_history"
+}
+
+// handleHistory is the history middleware of the connection
+// It copies the documents op is going to change to the history collection if their model has history.
+// The copies are written with ctx, so in the transaction of ctx if there is one. Operations on one document are
+// narrowed to the _id of the copied version. Outside of a transaction, a version written by another client between
+// the copy and the operation is not recorded
+func (c *Connection) handleHistory(ctx context.Context, op *middleware.Operation, next middleware.Handler) error {
+	switch op.Type {
+	case operator.OpReplace, operator.OpUpsert, operator.OpUpdate, operator.OpApply, operator.OpRemove:
+	default:
+		return next(ctx, op)
+	}
+
+	if h, ok := c.modelOf(op.Database, op.Collection).(HistoryHook); !ok || !h.History() {
+		return next(ctx, op)
+	}
+
+	db := c.Client.Database(op.Database)
+
+	findOpts := historyFindOptions(op.Options)
+
+	if !op.Many {
+		findOpts.SetLimit(1)
+	}
+
+	cur, err := db.Collection(op.Collection).Find(ctx, filterOf(op.Filter), findOpts)
+
+	if err != nil {
+		return err
+	}
+
+	var docs []bson.Raw
+
+	if err = cur.All(ctx, &docs); err != nil {
+		return err
+	}
+
+	if len(docs) == 0 {
+		return next(ctx, op)
+	}
+
+	ids := make(bson.A, len(docs))
+
+	for i, doc := range docs {
+		ids[i] = doc.Lookup("_id")
+	}
+
+	if !op.Many {
+		op.Filter = bson.D{{Key: "$and", Value: bson.A{filterOf(op.Filter), bson.D{{Key: "_id", Value: ids[0]}}}}}
+	}
+
+	if err = saveRevisions(ctx, db.Collection(historyName(op.Collection)), op.Type, ids, docs); err != nil {
+		return err
+	}
+
+	return next(ctx, op)
+}
+
+// historyFindOptions returns the options finding the documents the operation with opts changes
+func historyFindOptions(opts interface{}) *options.FindOptions {
+	find := options.Find()
+
+	switch o := opts.(type) {
+	case *options.UpdateOptions:
+		find.Collation = o.Collation
+	case *options.ReplaceOptions:
+		find.Collation = o.Collation
+	case *options.DeleteOptions:
+		find.Collation = o.Collation
+	case *options.FindOneAndUpdateOptions:
+		find.Collation, find.Sort = o.Collation, o.Sort
+	case *options.FindOneAndReplaceOptions:
+		find.Collation, find.Sort = o.Collation, o.Sort
+	case *options.FindOneAndDeleteOptions:
+		find.Collation, find.Sort = o.Collation, o.Sort
+	}
+
+	return find
+}
+
+// filterOf returns filter, an empty document if it is nil
+func filterOf(filter interface{}) interface{} {
+	if filter == nil {
+		return bson.D{}
+	}
+
+	return filter
+}
+
+// saveRevisions writes docs as the next revisions of the documents with the ids to history
+func saveRevisions(ctx context.Context, history *mongo.Collection, opType operator.OpType, ids bson.A, docs []bson.Raw) error {
+	cur, err := history.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"documentId": bson.M{"$in": ids}}},
+		bson.M{"$group": bson.M{"_id": "$documentId", "revision": bson.M{"$max": "$revision"}}},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var last []struct {
+		Id       bson.RawValue `bson:"_id"`
+		Revision int64         `bson:"revision"`
+	}
+
+	if err = cur.All(ctx, &last); err != nil {
+		return err
+	}
+
+	revisions := make(map[string]int64, len(last))
+
+	for _, l := range last {
+		revisions[idKey(l.Id)] = l.Revision
+	}
+
+	actor, _ := field.ActorFrom(ctx)
+
+	now := Now()
+
+	revs := make([]interface{}, len(docs))
+
+	for i, doc := range docs {
+		id := ids[i].(bson.RawValue)
+
+		revs[i] = &Revision{
+			Id:         NewObjectID(),
+			DocumentId: id,
+			Revision:   revisions[idKey(id)] + 1,
+			Op:         opType,
+			Actor:      actor,
+			CreateAt:   now,
+			Document:   doc,
+		}
+	}
+
+	_, err = history.InsertMany(ctx, revs)
+
+	return err
+}
+
+// idKey returns a key of the map of revisions for the id value
+func idKey(id bson.RawValue) string {
+	return string([]byte{byte(id.Type)}) + string(id.Value)
+}
+
+// HistoryCollection returns the collection keeping the prior versions of the documents of c, named <coll>_history
+func (c *Collection) HistoryCollection() *Collection {
+	return c.connection.Database(c.collection.Database().Name()).Collection(historyName(c.collection.Name()))
+}
+
+// EnsureHistoryIndexes creates the unique index on the document id and the revision of the history collection
+// Concurrent writers of one document outside of a transaction then fail instead of recording a revision twice
+func (c *Collection) EnsureHistoryIndexes(ctx context.Context) error {
+	return c.HistoryCollection().CreateIndexes(ctx, []gOpts.IndexModel{
+		{Key: []string{"documentId", "revision"}, IndexOptions: options.Index().SetUnique(true)},
+	})
+}
+
+// Revisions returns the prior versions of the document with the id, the oldest first
+func (c *Collection) Revisions(ctx context.Context, id interface{}) ([]*Revision, error) {
+	var revisions []*Revision
+
+	_, err := c.HistoryCollection().Find().Where(map[string]any{"documentId": id}).Sort("revision").All(ctx, &revisions)
+
+	return revisions, err
+}
+
+// Revision returns the version revision of the document with the id, ErrNoSuchDocuments if there is none
+func (c *Collection) Revision(ctx context.Context, id interface{}, revision int64) (*Revision, error) {
+	var rev Revision
+
+	err := c.HistoryCollection().Find().WithContext(ctx).Where(map[string]any{"documentId": id, "revision": revision}).One(&rev)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// DiffRevisions returns the differences from the version from to the version to of the document with the id
+// CurrentRevision stands for the current version of the document
+func (c *Collection) DiffRevisions(ctx context.Context, id interface{}, from int64, to int64) ([]RevisionDiff, error) {
+	a, err := c.version(ctx, id, from)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.version(ctx, id, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return diffDocuments(nil, "", a, b), nil
+}
+
+// version returns the version revision of the document with the id
+func (c *Collection) version(ctx context.Context, id interface{}, revision int64) (bson.Raw, error) {
+	if revision == CurrentRevision {
+		var doc bson.Raw
+
+		err := c.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+
+		return doc, err
+	}
+
+	rev, err := c.Revision(ctx, id, revision)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rev.Document, nil
+}
+
+// RestoreRevision replaces the document with the id by its version revision, or inserts it again if it was removed
+// The version is decoded into the model of the collection, so fields, validation and hooks run as for Upsert, and
+// the replaced version is kept in the history
+func (c *Collection) RestoreRevision(ctx context.Context, id interface{}, revision int64) error {
+	rev, err := c.Revision(ctx, id, revision)
+
+	if err != nil {
+		return err
+	}
+
+	var doc interface{} = &bson.M{}
+
+	if model := c.model(); model != nil {
+		doc = reflect.New(reflect.TypeOf(model).Elem()).Interface()
+	}
+
+	if c.registry != nil {
+		err = bson.UnmarshalWithRegistry(c.registry, rev.Document, doc)
+	} else {
+		err = bson.Unmarshal(rev.Document, doc)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = c.UpsertId(ctx, id, doc)
+
+	return err
+}
+
+// diffDocuments appends the differences from the document a to the document b, whose path is path, to diffs
+func diffDocuments(diffs []RevisionDiff, path string, a bson.Raw, b bson.Raw) []RevisionDiff {
+	elems, _ := a.Elements()
+
+	for _, e := range elems {
+		p := e.Key()
+
+		if path != "" {
+			p = path + "." + p
+		}
+
+		av := e.Value()
+
+		bv, err := b.LookupErr(e.Key())
+
+		switch {
+		case err != nil:
+			diffs = append(diffs, RevisionDiff{Path: p, Kind: DiffRemoved, From: rawInterface(av)})
+		case av.Type == bsontype.EmbeddedDocument && bv.Type == bsontype.EmbeddedDocument:
+			diffs = diffDocuments(diffs, p, av.Document(), bv.Document())
+		case !av.Equal(bv):
+			diffs = append(diffs, RevisionDiff{Path: p, Kind: DiffChanged, From: rawInterface(av), To: rawInterface(bv)})
+		}
+	}
+
+	elems, _ = b.Elements()
+
+	for _, e := range elems {
+		if _, err := a.LookupErr(e.Key()); err == nil {
+			continue
+		}
+
+		p := e.Key()
+
+		if path != "" {
+			p = path + "." + p
+		}
+
+		diffs = append(diffs, RevisionDiff{Path: p, Kind: DiffAdded, To: rawInterface(e.Value())})
+	}
+
+	return diffs
+}
+
+// rawInterface decodes the value v
+func rawInterface(v bson.RawValue) interface{} {
+	var i interface{}
+
+	if err := v.Unmarshal(&i); err != nil {
+		return v
+	}
+
+	return i
+}
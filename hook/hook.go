@@ -4,11 +4,13 @@ import (
 	"context"
 	"reflect"
 
+	"github.com/md-salehzadeh/godm/middleware"
 	"github.com/md-salehzadeh/godm/operator"
 )
 
 // hookHandler defines the relations between hook type and handler
-var hookHandler = map[operator.OpType]func(ctx context.Context, hook interface{}) error{
+// The op is nil when the hook is called through Do, hooks taking the operation are skipped then
+var hookHandler = map[operator.OpType]func(ctx context.Context, hook interface{}, op *middleware.Operation) error{
 	operator.BeforeInsert:  beforeInsert,
 	operator.AfterInsert:   afterInsert,
 	operator.BeforeUpdate:  beforeUpdate,
@@ -30,37 +32,83 @@ var hookHandler = map[operator.OpType]func(ctx context.Context, hook interface{}
 
 // Do call the specific method to handle hook based on hType
 // If opts has valid value, use it instead of original hook
+// Hooks taking the operation are only called by Handle
 func Do(ctx context.Context, hook interface{}, opType operator.OpType, opts ...interface{}) error {
 	if len(opts) > 0 {
 		hook = opts[0]
 	}
 
+	return handle(ctx, hook, opType, nil)
+}
+
+// Handle is the middleware calling the hooks of op before and after it
+// The hook of op is used if set, otherwise the documents of op
+// Hooks taking the operation are called after the ones taking only the context, before-hooks may
+// change the filter or the update of op, after-hooks can read its result
+func Handle(ctx context.Context, op *middleware.Operation, next middleware.Handler) error {
+	if err := Before(ctx, op); err != nil {
+		return err
+	}
+
+	if err := next(ctx, op); err != nil {
+		return err
+	}
+
+	return After(ctx, op)
+}
+
+// Before calls the before-hooks of op
+func Before(ctx context.Context, op *middleware.Operation) error {
+	if before := op.Type.Before(); before != "" {
+		return handle(ctx, target(op), before, op)
+	}
+	return nil
+}
+
+// After calls the after-hooks of op
+func After(ctx context.Context, op *middleware.Operation) error {
+	if after := op.Type.After(); after != "" {
+		return handle(ctx, target(op), after, op)
+	}
+	return nil
+}
+
+// target returns the hook of op, or its documents if no hook is set
+func target(op *middleware.Operation) interface{} {
+	if op.Hook != nil {
+		return op.Hook
+	}
+	return op.Documents
+}
+
+// handle calls the hooks of one hook or every hook of a slice
+func handle(ctx context.Context, hook interface{}, opType operator.OpType, op *middleware.Operation) error {
 	to := reflect.TypeOf(hook)
 	if to == nil {
 		return nil
 	}
 	switch to.Kind() {
 	case reflect.Slice:
-		return sliceHandle(ctx, hook, opType)
+		return sliceHandle(ctx, hook, opType, op)
 	case reflect.Ptr:
 		v := reflect.ValueOf(hook).Elem()
 		switch v.Kind() {
 		case reflect.Slice:
-			return sliceHandle(ctx, v.Interface(), opType)
+			return sliceHandle(ctx, v.Interface(), opType, op)
 		default:
-			return do(ctx, hook, opType)
+			return do(ctx, hook, opType, op)
 		}
 	default:
-		return do(ctx, hook, opType)
+		return do(ctx, hook, opType, op)
 	}
 }
 
 // sliceHandle handles the slice hooks
-func sliceHandle(ctx context.Context, hook interface{}, opType operator.OpType) error {
+func sliceHandle(ctx context.Context, hook interface{}, opType operator.OpType, op *middleware.Operation) error {
 	// []interface{}{UserType{}...}
 	if h, ok := hook.([]interface{}); ok {
 		for _, v := range h {
-			if err := do(ctx, v, opType); err != nil {
+			if err := do(ctx, v, opType, op); err != nil {
 				return err
 			}
 		}
@@ -69,7 +117,7 @@ func sliceHandle(ctx context.Context, hook interface{}, opType operator.OpType)
 	// []UserType{}
 	s := reflect.ValueOf(hook)
 	for i := 0; i < s.Len(); i++ {
-		if err := do(ctx, s.Index(i).Interface(), opType); err != nil {
+		if err := do(ctx, s.Index(i).Interface(), opType, op); err != nil {
 			return err
 		}
 	}
@@ -84,18 +132,36 @@ type AfterInsertHook interface {
 	AfterInsert(ctx context.Context) error
 }
 
-// beforeInsert calls custom BeforeInsert
-func beforeInsert(ctx context.Context, hook interface{}) error {
+// BeforeInsertWithOpHook defines the insert hook interface which gets the operation
+type BeforeInsertWithOpHook interface {
+	BeforeInsertWithOp(ctx context.Context, op *middleware.Operation) error
+}
+type AfterInsertWithOpHook interface {
+	AfterInsertWithOp(ctx context.Context, op *middleware.Operation) error
+}
+
+// beforeInsert calls custom BeforeInsert and BeforeInsertWithOp
+func beforeInsert(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(BeforeInsertHook); ok {
-		return ih.BeforeInsert(ctx)
+		if err := ih.BeforeInsert(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(BeforeInsertWithOpHook); ok && op != nil {
+		return ih.BeforeInsertWithOp(ctx, op)
 	}
 	return nil
 }
 
-// afterInsert calls custom AfterInsert
-func afterInsert(ctx context.Context, hook interface{}) error {
+// afterInsert calls custom AfterInsert and AfterInsertWithOp
+func afterInsert(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(AfterInsertHook); ok {
-		return ih.AfterInsert(ctx)
+		if err := ih.AfterInsert(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(AfterInsertWithOpHook); ok && op != nil {
+		return ih.AfterInsertWithOp(ctx, op)
 	}
 	return nil
 }
@@ -108,18 +174,36 @@ type AfterUpdateHook interface {
 	AfterUpdate(ctx context.Context) error
 }
 
-// beforeUpdate calls custom BeforeUpdate
-func beforeUpdate(ctx context.Context, hook interface{}) error {
+// BeforeUpdateWithOpHook defines the update hook interface which gets the operation
+type BeforeUpdateWithOpHook interface {
+	BeforeUpdateWithOp(ctx context.Context, op *middleware.Operation) error
+}
+type AfterUpdateWithOpHook interface {
+	AfterUpdateWithOp(ctx context.Context, op *middleware.Operation) error
+}
+
+// beforeUpdate calls custom BeforeUpdate and BeforeUpdateWithOp
+func beforeUpdate(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(BeforeUpdateHook); ok {
-		return ih.BeforeUpdate(ctx)
+		if err := ih.BeforeUpdate(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(BeforeUpdateWithOpHook); ok && op != nil {
+		return ih.BeforeUpdateWithOp(ctx, op)
 	}
 	return nil
 }
 
-// afterUpdate calls custom AfterUpdate
-func afterUpdate(ctx context.Context, hook interface{}) error {
+// afterUpdate calls custom AfterUpdate and AfterUpdateWithOp
+func afterUpdate(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(AfterUpdateHook); ok {
-		return ih.AfterUpdate(ctx)
+		if err := ih.AfterUpdate(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(AfterUpdateWithOpHook); ok && op != nil {
+		return ih.AfterUpdateWithOp(ctx, op)
 	}
 	return nil
 }
@@ -132,18 +216,36 @@ type AfterQueryHook interface {
 	AfterQuery(ctx context.Context) error
 }
 
-// beforeQuery calls custom BeforeQuery
-func beforeQuery(ctx context.Context, hook interface{}) error {
+// BeforeQueryWithOpHook defines the query hook interface which gets the operation
+type BeforeQueryWithOpHook interface {
+	BeforeQueryWithOp(ctx context.Context, op *middleware.Operation) error
+}
+type AfterQueryWithOpHook interface {
+	AfterQueryWithOp(ctx context.Context, op *middleware.Operation) error
+}
+
+// beforeQuery calls custom BeforeQuery and BeforeQueryWithOp
+func beforeQuery(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(BeforeQueryHook); ok {
-		return ih.BeforeQuery(ctx)
+		if err := ih.BeforeQuery(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(BeforeQueryWithOpHook); ok && op != nil {
+		return ih.BeforeQueryWithOp(ctx, op)
 	}
 	return nil
 }
 
-// afterQuery calls custom AfterQuery
-func afterQuery(ctx context.Context, hook interface{}) error {
+// afterQuery calls custom AfterQuery and AfterQueryWithOp
+func afterQuery(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(AfterQueryHook); ok {
-		return ih.AfterQuery(ctx)
+		if err := ih.AfterQuery(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(AfterQueryWithOpHook); ok && op != nil {
+		return ih.AfterQueryWithOp(ctx, op)
 	}
 	return nil
 }
@@ -156,18 +258,36 @@ type AfterRemoveHook interface {
 	AfterRemove(ctx context.Context) error
 }
 
-// beforeRemove calls custom BeforeRemove
-func beforeRemove(ctx context.Context, hook interface{}) error {
+// BeforeRemoveWithOpHook defines the remove hook interface which gets the operation
+type BeforeRemoveWithOpHook interface {
+	BeforeRemoveWithOp(ctx context.Context, op *middleware.Operation) error
+}
+type AfterRemoveWithOpHook interface {
+	AfterRemoveWithOp(ctx context.Context, op *middleware.Operation) error
+}
+
+// beforeRemove calls custom BeforeRemove and BeforeRemoveWithOp
+func beforeRemove(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(BeforeRemoveHook); ok {
-		return ih.BeforeRemove(ctx)
+		if err := ih.BeforeRemove(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(BeforeRemoveWithOpHook); ok && op != nil {
+		return ih.BeforeRemoveWithOp(ctx, op)
 	}
 	return nil
 }
 
-// afterRemove calls custom AfterRemove
-func afterRemove(ctx context.Context, hook interface{}) error {
+// afterRemove calls custom AfterRemove and AfterRemoveWithOp
+func afterRemove(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(AfterRemoveHook); ok {
-		return ih.AfterRemove(ctx)
+		if err := ih.AfterRemove(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(AfterRemoveWithOpHook); ok && op != nil {
+		return ih.AfterRemoveWithOp(ctx, op)
 	}
 	return nil
 }
@@ -180,27 +300,45 @@ type AfterUpsertHook interface {
 	AfterUpsert(ctx context.Context) error
 }
 
-// beforeUpsert calls custom BeforeUpsert
-func beforeUpsert(ctx context.Context, hook interface{}) error {
+// BeforeUpsertWithOpHook defines the upsert hook interface which gets the operation
+type BeforeUpsertWithOpHook interface {
+	BeforeUpsertWithOp(ctx context.Context, op *middleware.Operation) error
+}
+type AfterUpsertWithOpHook interface {
+	AfterUpsertWithOp(ctx context.Context, op *middleware.Operation) error
+}
+
+// beforeUpsert calls custom BeforeUpsert and BeforeUpsertWithOp
+func beforeUpsert(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(BeforeUpsertHook); ok {
-		return ih.BeforeUpsert(ctx)
+		if err := ih.BeforeUpsert(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(BeforeUpsertWithOpHook); ok && op != nil {
+		return ih.BeforeUpsertWithOp(ctx, op)
 	}
 	return nil
 }
 
-// afterUpsert calls custom AfterUpsert
-func afterUpsert(ctx context.Context, hook interface{}) error {
+// afterUpsert calls custom AfterUpsert and AfterUpsertWithOp
+func afterUpsert(ctx context.Context, hook interface{}, op *middleware.Operation) error {
 	if ih, ok := hook.(AfterUpsertHook); ok {
-		return ih.AfterUpsert(ctx)
+		if err := ih.AfterUpsert(ctx); err != nil {
+			return err
+		}
+	}
+	if ih, ok := hook.(AfterUpsertWithOpHook); ok && op != nil {
+		return ih.AfterUpsertWithOp(ctx, op)
 	}
 	return nil
 }
 
 // do check if opType is supported and call hookHandler
-func do(ctx context.Context, hook interface{}, opType operator.OpType) error {
+func do(ctx context.Context, hook interface{}, opType operator.OpType, op *middleware.Operation) error {
 	if f, ok := hookHandler[opType]; !ok {
 		return nil
 	} else {
-		return f(ctx, hook)
+		return f(ctx, hook, op)
 	}
 }
@@ -1,6 +1,16 @@
 package godm
 
-import "context"
+import (
+	"context"
+
+	"github.com/md-salehzadeh/godm/middleware"
+)
+
+// Operation describes the operation passed to middlewares and to the hooks taking the operation,
+// like BeforeUpdateWithOp(ctx context.Context, op *godm.Operation) error
+// Before-hooks may rewrite Filter and Update, after-hooks get the InsertOneResult, InsertManyResult,
+// UpdateResult or DeleteResult of the operation in Result
+type Operation = middleware.Operation
 
 // CollectionI
 //type CollectionI interface {
@@ -52,6 +62,7 @@ type QueryI interface {
 	Cursor() CursorI
 	Apply(change Change, result interface{}) error
 	Hint(hint interface{}) QueryI
+	WithContext(ctx context.Context) QueryI
 }
 
 // AggregateI define the interface of aggregate
@@ -2,33 +2,281 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"sync"
 
-	"github.com/md-salehzadeh/godm/field"
-	"github.com/md-salehzadeh/godm/hook"
 	"github.com/md-salehzadeh/godm/operator"
-	"github.com/md-salehzadeh/godm/validator"
 )
 
-// callback define the callback function type
-type callback func(ctx context.Context, doc interface{}, opType operator.OpType, opts ...interface{}) error
+var (
+	// ErrDuplicateName return if a middleware is registered under a name already used in the chain
+	ErrDuplicateName = errors.New("middleware name already registered in chain")
+	// ErrNotRegistered return if the middleware to insert before or after is not in the chain
+	ErrNotRegistered = errors.New("middleware not registered in chain")
+)
+
+// define the names of the middlewares the chain of every Connection starts with, in this order
+const (
+	Hook      = "hook"
+	Field     = "field"
+	Validator = "validator"
+	History   = "history"
+	Callbacks = "callbacks"
+)
+
+// Operation describes one operation passing through the middleware chain
+// Middlewares may change the fields before calling next, the operation runs with the changed values
+type Operation struct {
+	Database   string          // name of the database
+	Collection string          // name of the collection
+	Type       operator.OpType // type of the operation, like operator.OpInsert
+	Filter     interface{}     // query filter, nil for inserts
+	Many       bool            // the operation writes every document matching Filter, like UpdateAll and RemoveAll
+	Update     interface{}     // update document of update operations
+	Documents  interface{}     // document or slice of documents to insert, replace or upsert
+	Pipeline   interface{}     // pipeline of Aggregate and Watch
+	Key        string          // field of Distinct
+	Hook       interface{}     // the hook of the operation, from options or the document itself
+	Model      interface{}     // document of the model of the collection, nil if the collection has no model
+	Options    interface{}     // options passed to the official driver
+	Result     interface{}     // result of the operation, set once the operation ran
+}
+
+// Handler runs an operation
+type Handler func(ctx context.Context, op *Operation) error
+
+// Middleware wraps operations, the operation only continues when Handle calls next
+// The error and the Result of the operation are available once next returned
+type Middleware interface {
+	Handle(ctx context.Context, op *Operation, next Handler) error
+}
+
+// Func adapts a function to the Middleware interface
+type Func func(ctx context.Context, op *Operation, next Handler) error
+
+// Handle calls f(ctx, op, next)
+func (f Func) Handle(ctx context.Context, op *Operation, next Handler) error {
+	return f(ctx, op, next)
+}
+
+// Callback is a function called before and after an operation
+// The doc is the document to operate, or the hook if there is no document; opts holds the hook if one is set
+type Callback func(ctx context.Context, doc interface{}, opType operator.OpType, opts ...interface{}) error
+
+// Handle adapts the callback to the Middleware interface
+// The callback is called with the before type of the operation, then next, then the callback again
+// with the after type if next succeeded
+func (cb Callback) Handle(ctx context.Context, op *Operation, next Handler) error {
+	doc := op.Documents
+
+	if doc == nil {
+		doc = op.Hook
+	}
+
+	var opts []interface{}
+
+	if op.Hook != nil {
+		opts = append(opts, op.Hook)
+	}
+
+	if before := op.Type.Before(); before != "" {
+		if err := cb(ctx, doc, before, opts...); err != nil {
+			return err
+		}
+	}
+
+	if err := next(ctx, op); err != nil {
+		return err
+	}
+
+	if after := op.Type.After(); after != "" {
+		return cb(ctx, doc, after, opts...)
+	}
+
+	return nil
+}
+
+// entry is a named middleware of a chain
+type entry struct {
+	name       string
+	middleware Middleware
+}
+
+// Chain is an ordered list of named middlewares
+// A chain runs inside its parent: the middlewares of the parent wrap the middlewares of the chain
+// Chain is safe for concurrent use
+type Chain struct {
+	parent *Chain
+
+	mu      sync.RWMutex
+	entries []entry
+}
+
+// NewChain creates an empty chain running inside parent, parent can be nil
+func NewChain(parent *Chain) *Chain {
+	return &Chain{parent: parent}
+}
+
+// Use appends a middleware to the end of the chain, it runs closest to the operation
+func (c *Chain) Use(name string, m Middleware) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index(name) >= 0 {
+		return ErrDuplicateName
+	}
+
+	c.entries = append(c.entries, entry{name: name, middleware: m})
+
+	return nil
+}
+
+// UseBefore inserts a middleware before the one registered as mark, so it wraps it
+func (c *Chain) UseBefore(mark string, name string, m Middleware) error {
+	return c.insert(mark, 0, name, m)
+}
+
+// UseAfter inserts a middleware after the one registered as mark, so it is wrapped by it
+func (c *Chain) UseAfter(mark string, name string, m Middleware) error {
+	return c.insert(mark, 1, name, m)
+}
+
+// insert inserts a middleware at the position of mark plus offset
+func (c *Chain) insert(mark string, offset int, name string, m Middleware) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index(name) >= 0 {
+		return ErrDuplicateName
+	}
 
-// middlewareCallback the register callback slice
-// some callbacks initial here without Register() for order
-var middlewareCallback = []callback{
-	hook.Do,
-	field.Do,
-	validator.Do,
+	i := c.index(mark)
+
+	if i < 0 {
+		return ErrNotRegistered
+	}
+
+	i += offset
+
+	c.entries = append(c.entries, entry{})
+	copy(c.entries[i+1:], c.entries[i:])
+	c.entries[i] = entry{name: name, middleware: m}
+
+	return nil
+}
+
+// Remove removes the middleware registered as name, it reports if the middleware was found
+func (c *Chain) Remove(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i := c.index(name)
+
+	if i < 0 {
+		return false
+	}
+
+	c.entries = append(c.entries[:i:i], c.entries[i+1:]...)
+
+	return true
+}
+
+// Names returns the names of the middlewares of the chain in order, without the ones of the parent
+func (c *Chain) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.entries))
+
+	for _, e := range c.entries {
+		names = append(names, e.name)
+	}
+
+	return names
+}
+
+// Only returns a chain of the middlewares of the parents and the chain registered as one of names, in order
+// The returned chain has no parent and does not follow later changes of c
+func (c *Chain) Only(names ...string) *Chain {
+	only := NewChain(nil)
+
+	for _, e := range c.all() {
+		for _, name := range names {
+			if e.name == name {
+				only.entries = append(only.entries, e)
+
+				break
+			}
+		}
+	}
+
+	return only
 }
 
+// Run runs op through the middlewares of the parents and the chain, final performs the operation itself
+func (c *Chain) Run(ctx context.Context, op *Operation, final Handler) error {
+	entries := c.all()
+
+	h := final
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		m, next := entries[i].middleware, h
+
+		h = func(ctx context.Context, op *Operation) error {
+			return m.Handle(ctx, op, next)
+		}
+	}
+
+	return h(ctx, op)
+}
+
+// all returns the entries of the parents followed by the ones of the chain
+func (c *Chain) all() []entry {
+	if c == nil {
+		return nil
+	}
+
+	entries := c.parent.all()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append(entries, c.entries...)
+}
+
+// index returns the position of name in the chain, -1 if it is not registered
+// The caller must hold the lock
+func (c *Chain) index(name string) int {
+	for i, e := range c.entries {
+		if e.name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// callbacks the globally registered callbacks
+var callbacks []Callback
+
 // Register register callback into middleware
-func Register(cb callback) {
-	middlewareCallback = append(middlewareCallback, cb)
+// Deprecated: callbacks registered here are shared by every Connection of the process,
+// use the Use method of the middleware chain of a Connection, Database or Collection instead
+func Register(cb Callback) {
+	callbacks = append(callbacks, cb)
 }
 
-// Do call every registers
-// The doc is always the document to operate
+// Do calls the callbacks registered by Register
+// Deprecated: Do no longer runs hook.Do, field.Do and validator.Do first, they run as the middlewares Hook, Field and
+// Validator of every Connection now. Call them before RunCallbacks to keep the former behaviour
 func Do(ctx context.Context, doc interface{}, opType operator.OpType, opts ...interface{}) error {
-	for _, cb := range middlewareCallback {
+	return RunCallbacks(ctx, doc, opType, opts...)
+}
+
+// RunCallbacks calls the callbacks registered by Register, it is the Callbacks middleware of every Connection
+// The doc is always the document to operate
+func RunCallbacks(ctx context.Context, doc interface{}, opType operator.OpType, opts ...interface{}) error {
+	for _, cb := range callbacks {
 		if err := cb(ctx, doc, opType, opts...); err != nil {
 			return err
 		}
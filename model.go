@@ -23,6 +23,9 @@ func (c *Connection) RegisterModel(document interface{}, collName string) {
 
 	typeName := strings.ToLower(reflectType.Elem().Name())
 
+	c.modelMu.Lock()
+	defer c.modelMu.Unlock()
+
 	if _, ok := c.modelRegistry[typeName]; !ok {
 		collection := c.Database(c.Config.Database).Collection(collName)
 
@@ -34,16 +37,33 @@ func (c *Connection) RegisterModel(document interface{}, collName string) {
 
 		c.modelRegistry[typeName] = model
 		c.typeRegistry[typeName] = reflectType.Elem()
+		c.collModels[c.Config.Database+"."+collName] = model
 	} else {
 		fmt.Printf("Tried to register model '%v' twice\n", typeName)
 	}
 }
 
+// modelOf returns the document of the model registered for the collection coll of the database db, nil if there is none
+func (c *Connection) modelOf(db string, coll string) interface{} {
+	c.modelMu.RLock()
+	defer c.modelMu.RUnlock()
+
+	if m, ok := c.collModels[db+"."+coll]; ok {
+		return m.document
+	}
+
+	return nil
+}
+
 func (c *Connection) Model(name string) *Model {
 	_name := strings.ToLower(name)
 
-	if _, ok := c.modelRegistry[_name]; ok {
-		return c.modelRegistry[_name]
+	c.modelMu.RLock()
+	m, ok := c.modelRegistry[_name]
+	c.modelMu.RUnlock()
+
+	if ok {
+		return m
 	}
 
 	panic(fmt.Sprintf("DB: Model '%v' is not registered", name))
@@ -15,4 +15,62 @@ const (
 	AfterUpsert   OpType = "afterUpsert"
 	BeforeReplace OpType = "beforeReplace"
 	AfterReplace  OpType = "afterReplace"
+
+	BeforeApply     OpType = "beforeApply"
+	AfterApply      OpType = "afterApply"
+	BeforeAggregate OpType = "beforeAggregate"
+	AfterAggregate  OpType = "afterAggregate"
+	BeforeDistinct  OpType = "beforeDistinct"
+	AfterDistinct   OpType = "afterDistinct"
+	BeforeCount     OpType = "beforeCount"
+	AfterCount      OpType = "afterCount"
+	BeforeCursor    OpType = "beforeCursor"
+	AfterCursor     OpType = "afterCursor"
+	BeforeWatch     OpType = "beforeWatch"
+	AfterWatch      OpType = "afterWatch"
+)
+
+// define the types of the operations passing through the middleware chain
+// each one has a before and an after type, see Before and After
+const (
+	OpInsert  OpType = "insert"
+	OpUpdate  OpType = "update"
+	OpQuery   OpType = "query"
+	OpRemove  OpType = "remove"
+	OpUpsert  OpType = "upsert"
+	OpReplace OpType = "replace"
+
+	OpApply     OpType = "apply"
+	OpAggregate OpType = "aggregate"
+	OpDistinct  OpType = "distinct"
+	OpCount     OpType = "count"
+	OpCursor    OpType = "cursor"
+	OpWatch     OpType = "watch"
 )
+
+// phases defines the before and after types of every operation type
+var phases = map[OpType][2]OpType{
+	OpInsert:  {BeforeInsert, AfterInsert},
+	OpUpdate:  {BeforeUpdate, AfterUpdate},
+	OpQuery:   {BeforeQuery, AfterQuery},
+	OpRemove:  {BeforeRemove, AfterRemove},
+	OpUpsert:  {BeforeUpsert, AfterUpsert},
+	OpReplace: {BeforeReplace, AfterReplace},
+
+	OpApply:     {BeforeApply, AfterApply},
+	OpAggregate: {BeforeAggregate, AfterAggregate},
+	OpDistinct:  {BeforeDistinct, AfterDistinct},
+	OpCount:     {BeforeCount, AfterCount},
+	OpCursor:    {BeforeCursor, AfterCursor},
+	OpWatch:     {BeforeWatch, AfterWatch},
+}
+
+// Before returns the type called before an operation of type t, empty if t is not an operation type
+func (t OpType) Before() OpType {
+	return phases[t][0]
+}
+
+// After returns the type called after an operation of type t, empty if t is not an operation type
+func (t OpType) After() OpType {
+	return phases[t][1]
+}
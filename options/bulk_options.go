@@ -0,0 +1,34 @@
+package options
+
+import "go.mongodb.org/mongo-driver/mongo/options"
+
+// BulkUpdateOptions configures an update queued in a Bulk
+type BulkUpdateOptions struct {
+	// Collation is the collation of the filter.
+	Collation *options.Collation
+	// Hint is the index the filter uses, its name or its key document.
+	Hint interface{}
+	// ArrayFilters are the filters of the filtered positional paths of the update, added to the ones of an
+	// UpdateBuilder.
+	ArrayFilters *options.ArrayFilters
+	// Upsert inserts a document if the filter matches none.
+	Upsert *bool
+}
+
+// BulkReplaceOptions configures a replace queued in a Bulk
+type BulkReplaceOptions struct {
+	// Collation is the collation of the filter.
+	Collation *options.Collation
+	// Hint is the index the filter uses, its name or its key document.
+	Hint interface{}
+	// Upsert inserts the replacement if the filter matches no document.
+	Upsert *bool
+}
+
+// BulkDeleteOptions configures a delete queued in a Bulk
+type BulkDeleteOptions struct {
+	// Collation is the collation of the filter.
+	Collation *options.Collation
+	// Hint is the index the filter uses, its name or its key document.
+	Hint interface{}
+}
@@ -0,0 +1,12 @@
+package options
+
+// SyncOptions configures Collection.SyncDocuments
+type SyncOptions struct {
+	// Filter restricts the documents of the collection compared with the dataset, the others are neither replaced
+	// nor deleted. The default is every document.
+	Filter interface{}
+	// HashField is the field storing the content hash of the documents. The default is "syncHash".
+	HashField string
+	// DryRun counts the changes without writing them.
+	DryRun bool
+}
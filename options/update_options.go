@@ -4,5 +4,17 @@ import "go.mongodb.org/mongo-driver/mongo/options"
 
 type UpdateOptions struct {
 	UpdateHook interface{}
+	// Model is a document of the model the update is validated against when validator.Config.Updates is set,
+	// the default is the model registered for the collection
+	Model interface{}
 	*options.UpdateOptions
 }
+
+// UpdateFromStructOptions configures Collection.UpdateFromStruct
+type UpdateFromStructOptions struct {
+	// Mask lists the bson paths of the fields to update, like "address.city", even if they are zero.
+	// Nil pointers of the mask are unset, so a field nulled by a client is named in the mask.
+	// The default is every non-zero field.
+	Mask []string
+	UpdateOptions
+}
@@ -0,0 +1,328 @@
+package godm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/md-salehzadeh/godm/operator"
+	gOpts "github.com/md-salehzadeh/godm/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// define the statuses of the events in the outbox
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxDone       = "done"
+	OutboxFailed     = "failed"
+)
+
+// Event is a domain event to publish through the outbox
+type Event struct {
+	// AggregateKey groups the events which are published in the order they were emitted, like "order:42"
+	AggregateKey string
+	// Type is the type of the event, like "order.created"
+	Type string
+	// Payload is the content of the event, it is stored as a BSON value
+	Payload interface{}
+}
+
+// OutboxEvent is an event stored in the outbox collection
+type OutboxEvent struct {
+	Id           primitive.ObjectID `bson:"_id"`
+	AggregateKey string             `bson:"aggregateKey"`
+	Type         string             `bson:"type"`
+	Payload      bson.RawValue      `bson:"payload"`
+	Status       string             `bson:"status"`
+	Attempts     int                `bson:"attempts"`
+	AvailableAt  time.Time          `bson:"availableAt"`
+	LeaseUntil   time.Time          `bson:"leaseUntil,omitempty"`
+	ClaimedBy    string             `bson:"claimedBy,omitempty"`
+	LastError    string             `bson:"lastError,omitempty"`
+	CreateAt     time.Time          `bson:"createAt"`
+	DoneAt       time.Time          `bson:"doneAt,omitempty"`
+}
+
+// Emit writes event to the outbox collection of the connection, in the transaction of ctx
+// It must be called with the context of a Connection.DoTransaction callback, otherwise ErrNotInTransaction is returned,
+// so the event is stored if and only if the transaction commits
+func Emit(ctx context.Context, event Event) error {
+	connection := txConnectionFrom(ctx)
+
+	if connection == nil {
+		return ErrNotInTransaction
+	}
+
+	payloadType, payload, err := bson.MarshalValue(event.Payload)
+
+	if err != nil {
+		return err
+	}
+
+	now := Now()
+
+	_, err = connection.OutboxCollection().InsertOne(ctx, &OutboxEvent{
+		Id:           NewObjectID(),
+		AggregateKey: event.AggregateKey,
+		Type:         event.Type,
+		Payload:      bson.RawValue{Type: payloadType, Value: payload},
+		Status:       OutboxPending,
+		AvailableAt:  now,
+		CreateAt:     now,
+	})
+
+	return err
+}
+
+// OutboxCollection returns the collection godm.Emit writes the events of the connection to
+func (c *Connection) OutboxCollection() *Collection {
+	name := c.Config.Outbox
+
+	if name == "" {
+		name = "outbox"
+	}
+
+	return c.Database(c.Config.Database).Collection(name)
+}
+
+// Publisher publishes the events of the outbox, to a message broker for example
+type Publisher interface {
+	Publish(ctx context.Context, event *OutboxEvent) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, event *OutboxEvent) error
+
+// Publish calls f(ctx, event)
+func (f PublisherFunc) Publish(ctx context.Context, event *OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// RelayOptions configures a Relay
+type RelayOptions struct {
+	// Id identifies the relay in the claimedBy field of the events, the default is the host name and the process id.
+	Id string
+	// PollInterval is the time to wait when there is no event to publish. The default is 1 second.
+	PollInterval time.Duration
+	// Lease is the time a claimed event is reserved for the relay, other relays claim it again once the lease
+	// expired. It must be longer than publishing takes. The default is 30 seconds.
+	Lease time.Duration
+	// MaxAttempts is the number of tries after which an event is marked as failed. The default is 10.
+	MaxAttempts int
+	// Backoff returns the time to wait before the next try of an event which failed attempts times.
+	// The default doubles from 1 second up to 5 minutes.
+	Backoff func(attempts int) time.Duration
+	// OnError is called with the errors of the outbox collection while Run keeps running.
+	OnError func(err error)
+}
+
+// Relay claims the pending events of the outbox, hands them to a Publisher and marks them done
+// Several relays may run on the same outbox: events are claimed with findAndModify, and an event is only
+// published once every earlier event of its aggregate key is done or failed
+type Relay struct {
+	outbox    *Collection
+	publisher Publisher
+	opts      RelayOptions
+}
+
+// Relay creates a Relay publishing the events of the outbox collection of the connection
+func (c *Connection) Relay(publisher Publisher, opts ...RelayOptions) *Relay {
+	var o RelayOptions
+
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.Id == "" {
+		host, _ := os.Hostname()
+
+		o.Id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+
+	if o.Lease <= 0 {
+		o.Lease = 30 * time.Second
+	}
+
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+
+	if o.Backoff == nil {
+		o.Backoff = func(attempts int) time.Duration {
+			return time.Duration(math.Min(float64(time.Second)*math.Pow(2, float64(attempts-1)), float64(5*time.Minute)))
+		}
+	}
+
+	return &Relay{
+		outbox:    c.OutboxCollection(),
+		publisher: publisher,
+		opts:      o,
+	}
+}
+
+// EnsureIndexes creates the indexes the relay queries the outbox with
+func (r *Relay) EnsureIndexes(ctx context.Context) error {
+	return r.outbox.CreateIndexes(ctx, []gOpts.IndexModel{
+		{Key: []string{"status", "availableAt"}},
+		{Key: []string{"aggregateKey", "_id"}},
+	})
+}
+
+// Run publishes events until ctx is done, it waits PollInterval whenever the outbox has no event to publish
+// Errors of the outbox collection are passed to OnError and Run carries on after PollInterval
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.RunOnce(ctx)
+
+		if err != nil && r.opts.OnError != nil {
+			r.opts.OnError(err)
+		}
+
+		if n > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.opts.PollInterval):
+		}
+	}
+}
+
+// RunOnce publishes events until none is available, it returns the number of events handed to the publisher
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	n := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		event, err := r.claim(ctx)
+
+		if err == ErrNoSuchDocuments {
+			return n, nil
+		}
+
+		if err != nil {
+			return n, err
+		}
+
+		blocked, err := r.blocked(ctx, event)
+
+		if err != nil {
+			return n, err
+		}
+
+		if blocked {
+			if err = r.release(ctx, event); err != nil {
+				return n, err
+			}
+
+			continue
+		}
+
+		n++
+
+		if err = r.publisher.Publish(ctx, event); err != nil {
+			err = r.fail(ctx, event, err)
+		} else {
+			err = r.done(ctx, event)
+		}
+
+		if err != nil && err != ErrNoSuchDocuments {
+			return n, err
+		}
+	}
+}
+
+// claim reserves the oldest available event for the relay
+// Pending events whose time has come and events whose lease expired are available
+func (r *Relay) claim(ctx context.Context) (*OutboxEvent, error) {
+	now := Now()
+
+	var event OutboxEvent
+
+	err := r.outbox.Find().
+		WithContext(ctx).
+		Where(map[string]any{"status": OutboxPending, "availableAt <=": now}).
+		OrWhere(map[string]any{"status": OutboxProcessing, "leaseUntil <": now}).
+		Sort("_id").
+		Apply(Change{
+			Update: bson.M{
+				operator.Set: bson.M{"status": OutboxProcessing, "claimedBy": r.opts.Id, "leaseUntil": now.Add(r.opts.Lease)},
+				operator.Inc: bson.M{"attempts": 1},
+			},
+			ReturnNew: true,
+		}, &event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// blocked checks if an earlier event of the aggregate key of event is still to be published
+func (r *Relay) blocked(ctx context.Context, event *OutboxEvent) (bool, error) {
+	n, err := r.outbox.Find().
+		WithContext(ctx).
+		Where(map[string]any{
+			"aggregateKey": event.AggregateKey,
+			"_id <":        event.Id,
+			"status in":    bson.A{OutboxPending, OutboxProcessing},
+		}).
+		Limit(1).
+		Count()
+
+	return n > 0, err
+}
+
+// release gives a blocked event back without counting the try
+func (r *Relay) release(ctx context.Context, event *OutboxEvent) error {
+	err := r.outbox.UpdateOne(ctx, bson.M{"_id": event.Id, "claimedBy": r.opts.Id}, bson.M{
+		operator.Set:   bson.M{"status": OutboxPending, "availableAt": Now().Add(r.opts.PollInterval)},
+		operator.Inc:   bson.M{"attempts": -1},
+		operator.Unset: bson.M{"claimedBy": "", "leaseUntil": ""},
+	})
+
+	if err == ErrNoSuchDocuments {
+		return nil
+	}
+
+	return err
+}
+
+// done marks a published event as done
+// It returns ErrNoSuchDocuments if another relay claimed the event meanwhile
+func (r *Relay) done(ctx context.Context, event *OutboxEvent) error {
+	return r.outbox.UpdateOne(ctx, bson.M{"_id": event.Id, "claimedBy": r.opts.Id}, bson.M{
+		operator.Set:   bson.M{"status": OutboxDone, "doneAt": Now()},
+		operator.Unset: bson.M{"claimedBy": "", "leaseUntil": ""},
+	})
+}
+
+// fail schedules the next try of an event the publisher failed on, or marks it failed after MaxAttempts tries
+// It returns ErrNoSuchDocuments if another relay claimed the event meanwhile
+func (r *Relay) fail(ctx context.Context, event *OutboxEvent, cause error) error {
+	set := bson.M{"status": OutboxFailed, "lastError": cause.Error()}
+
+	if event.Attempts < r.opts.MaxAttempts {
+		set["status"] = OutboxPending
+		set["availableAt"] = Now().Add(r.opts.Backoff(event.Attempts))
+	}
+
+	return r.outbox.UpdateOne(ctx, bson.M{"_id": event.Id, "claimedBy": r.opts.Id}, bson.M{
+		operator.Set:   set,
+		operator.Unset: bson.M{"claimedBy": "", "leaseUntil": ""},
+	})
+}
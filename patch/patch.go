@@ -0,0 +1,411 @@
+package patch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/md-salehzadeh/godm"
+	"github.com/md-salehzadeh/godm/field"
+	gOpts "github.com/md-salehzadeh/godm/options"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	// ErrInvalidPatch return if a patch document is malformed
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrUnsupportedOperation return if a patch operation has no translation to a single MongoDB update
+	ErrUnsupportedOperation = errors.New("unsupported patch operation")
+)
+
+// Update is the MongoDB update a patch translates to
+type Update struct {
+	model   interface{}
+	update  *godm.UpdateBuilder
+	filters bson.A
+}
+
+// Document returns the update document, godm.ErrUpdateEmpty if the patch changes nothing
+func (u *Update) Document() (bson.D, error) {
+	return u.update.Document()
+}
+
+// Filter returns the predicates of the test operations of the patch, nil if it has none
+func (u *Update) Filter() bson.D {
+	switch len(u.filters) {
+	case 0:
+		return nil
+	case 1:
+		return u.filters[0].(bson.D)
+	}
+
+	return bson.D{{Key: "$and", Value: u.filters}}
+}
+
+// UpdateOne applies the update to at most one document of coll matching filter and the tests of the patch
+// It runs Collection.UpdateOne with the model of the patch, so the update middlewares and validation apply.
+// godm.ErrNoSuchDocuments is returned if no document matches, a failed test included
+func (u *Update) UpdateOne(ctx context.Context, coll *godm.Collection, filter interface{}, opts ...gOpts.UpdateOptions) error {
+	if tests := u.Filter(); tests != nil {
+		filter = bson.D{{Key: "$and", Value: bson.A{filter, tests}}}
+	}
+
+	var o gOpts.UpdateOptions
+
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.Model == nil {
+		o.Model = u.model
+	}
+
+	return coll.UpdateOne(ctx, filter, u.update, o)
+}
+
+// operation is one operation of a JSON Patch
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch translates the RFC 6902 JSON Patch data into an update of the documents of model, like &User{}
+// The JSON pointers use the json names of the fields of model and become its bson paths:
+//   - add and replace become $set, add to an array index becomes $push at the position, "-" appends
+//   - remove becomes $unset, removing the element 0 of an array becomes $pop
+//   - move becomes $rename outside of arrays
+//   - test becomes a predicate of Filter
+//
+// Values are decoded into the types of the fields. Each path is changed once. Copy, moves from or to arrays and
+// removes of other array elements return ErrUnsupportedOperation
+func JSONPatch(model interface{}, data []byte) (*Update, error) {
+	var ops []operation
+
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	u, err := newUpdate(model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if err := u.apply(op); err != nil {
+			return nil, fmt.Errorf("operation %d, %s %s: %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return u, u.update.Err()
+}
+
+// MergePatch translates the RFC 7396 merge patch data into an update of the documents of model, like &User{}
+// Members with null values become $unset, objects merge into structs and maps field by field, and other values,
+// arrays included, become $set. Values are decoded into the types of the fields
+func MergePatch(model interface{}, data []byte) (*Update, error) {
+	u, err := newUpdate(model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !isObject(data) {
+		return nil, fmt.Errorf("%w: a merge patch must be an object", ErrInvalidPatch)
+	}
+
+	if err = u.merge("", data); err != nil {
+		return nil, err
+	}
+
+	return u, u.update.Err()
+}
+
+// newUpdate creates the empty Update of model
+func newUpdate(model interface{}) (*Update, error) {
+	if field.StructOf(reflect.TypeOf(model)) == nil {
+		return nil, fmt.Errorf("%w, got %T", field.ErrNotStructPointer, model)
+	}
+
+	return &Update{model: model, update: godm.Update()}, nil
+}
+
+// apply adds the JSON Patch operation op to the update
+func (u *Update) apply(op operation) error {
+	to, err := u.resolve(op.Path)
+
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := decode(to.t, op.Value)
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case to.array && to.index < 0:
+			u.update.Push(to.parent, value)
+		case to.array:
+			u.update.PushEach(to.parent, bson.A{value}, godm.EachPosition(to.index))
+		default:
+			u.update.Set(to.path, value)
+		}
+	case "replace":
+		if to.array && to.index < 0 {
+			return fmt.Errorf("%w: - only appends", ErrInvalidPatch)
+		}
+
+		value, err := decode(to.t, op.Value)
+
+		if err != nil {
+			return err
+		}
+
+		u.update.Set(to.path, value)
+	case "remove":
+		switch {
+		case to.array && to.index == 0:
+			u.update.PopFirst(to.parent)
+		case to.array:
+			return fmt.Errorf("%w: remove of the array element %d", ErrUnsupportedOperation, to.index)
+		default:
+			u.update.Unset(to.path)
+		}
+	case "move":
+		from, err := u.resolve(op.From)
+
+		if err != nil {
+			return err
+		}
+
+		if from.indexed || to.indexed {
+			return fmt.Errorf("%w: move from or to an array", ErrUnsupportedOperation)
+		}
+
+		u.update.Rename(from.path, to.path)
+	case "test":
+		if to.array && to.index < 0 {
+			return fmt.Errorf("%w: - only appends", ErrInvalidPatch)
+		}
+
+		value, err := decode(to.t, op.Value)
+
+		if err != nil {
+			return err
+		}
+
+		u.filters = append(u.filters, bson.D{{Key: to.path, Value: value}})
+	case "copy":
+		return fmt.Errorf("%w: copy", ErrUnsupportedOperation)
+	default:
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+
+	return u.update.Err()
+}
+
+// merge adds the merge patch object data of the JSON pointer prefix to the update
+func (u *Update) merge(prefix string, data []byte) error {
+	var members map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &members); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	keys := make([]string, 0, len(members))
+
+	for key := range members {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		pointer := prefix + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+
+		to, err := u.resolve(pointer)
+
+		if err != nil {
+			return err
+		}
+
+		value := members[key]
+
+		switch {
+		case bytes.Equal(bytes.TrimSpace(value), []byte("null")):
+			u.update.Unset(to.path)
+		case isObject(value) && mergeable(to.t):
+			err = u.merge(pointer, value)
+		default:
+			var v interface{}
+
+			if v, err = decode(to.t, value); err == nil {
+				u.update.Set(to.path, v)
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", pointer, err)
+		}
+	}
+
+	return nil
+}
+
+// target is the end of a JSON pointer in a model
+type target struct {
+	path    string       // dotted bson path
+	parent  string       // bson path of the parent
+	t       reflect.Type // type of the value
+	array   bool         // the parent is an array and the last segment its index
+	index   int          // index in the array, -1 for "-"
+	indexed bool         // the path goes through an array
+}
+
+// resolve translates the JSON pointer into the bson path of the model
+// An error wrapping field.ErrUnknownPath is returned if the pointer leaves the model
+func (u *Update) resolve(pointer string) (*target, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalidPatch, pointer)
+	}
+
+	to := &target{t: reflect.TypeOf(u.model)}
+
+	segments := strings.Split(pointer[1:], "/")
+
+	for i, segment := range segments {
+		segment = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+
+		for to.t.Kind() == reflect.Ptr {
+			to.t = to.t.Elem()
+		}
+
+		key := segment
+
+		to.array = false
+
+		switch to.t.Kind() {
+		case reflect.Struct:
+			f := jsonField(field.StructOf(to.t), segment)
+
+			if f == nil {
+				return nil, fmt.Errorf("%w: %s in %s", field.ErrUnknownPath, segment, to.t)
+			}
+
+			key, to.t = f.Key, f.Type
+		case reflect.Slice, reflect.Array:
+			to.array, to.indexed, to.t = true, true, to.t.Elem()
+
+			if segment == "-" && i == len(segments)-1 {
+				to.index = -1
+
+				break
+			}
+
+			n, err := strconv.Atoi(segment)
+
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%w: %s is not an index of %s", field.ErrUnknownPath, segment, pointer)
+			}
+
+			to.index = n
+		case reflect.Map:
+			to.t = to.t.Elem()
+		case reflect.Interface:
+		default:
+			return nil, fmt.Errorf("%w: %s in %s", field.ErrUnknownPath, segment, to.t)
+		}
+
+		to.parent = to.path
+
+		if to.path != "" {
+			to.path += "."
+		}
+
+		to.path += key
+	}
+
+	return to, nil
+}
+
+// jsonField returns the field of s with the json name, matched case-insensitively like encoding/json does if no
+// name is equal
+func jsonField(s *field.Struct, name string) *field.Field {
+	var fold *field.Field
+
+	for _, f := range s.Fields {
+		n, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+
+		if n == "-" {
+			continue
+		}
+
+		if n == "" {
+			n = f.Name
+		}
+
+		if n == name {
+			return f
+		}
+
+		if fold == nil && strings.EqualFold(n, name) {
+			fold = f
+		}
+	}
+
+	return fold
+}
+
+// decode decodes the JSON value data into a value of type t
+func decode(t reflect.Type, data json.RawMessage) (interface{}, error) {
+	v := reflect.New(t)
+
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return v.Elem().Interface(), nil
+}
+
+// isObject checks if the JSON value data is an object
+func isObject(data []byte) bool {
+	data = bytes.TrimSpace(data)
+
+	return len(data) > 0 && data[0] == '{'
+}
+
+// mergeable checks if a merge patch object merges into the values of type t member by member
+// Structs decoding JSON themselves, like time.Time, are replaced as a whole
+func mergeable(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Map, reflect.Interface:
+		return true
+	case reflect.Struct:
+		return !reflect.PtrTo(t).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem())
+	}
+
+	return false
+}
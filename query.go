@@ -30,6 +30,8 @@ type Query struct {
 	opts       []gOpts.FindOptions
 	registry   *bsoncodec.Registry
 	document   interface{}
+	model      interface{}
+	middleware *middleware.Chain
 }
 
 // BatchSize sets the value for the BatchSize field.
@@ -44,6 +46,34 @@ func (q *Query) setDocument(document interface{}) {
 	q.document = document
 }
 
+// WithContext sets the context used by One, Count, Distinct, Cursor and Apply
+func (q *Query) WithContext(ctx context.Context) QueryI {
+	q.ctx = ctx
+
+	return q
+}
+
+// queryHook returns the QueryHook of the find options, nil if there is none
+func (q *Query) queryHook() interface{} {
+	if len(q.opts) > 0 {
+		return q.opts[0].QueryHook
+	}
+
+	return nil
+}
+
+// do runs op through the middleware chain of the collection, exec performs the operation itself
+func (q *Query) do(ctx context.Context, op *middleware.Operation, exec middleware.Handler) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	op.Database = q.collection.Database().Name()
+	op.Collection = q.collection.Name()
+
+	return q.middleware.Run(ctx, op, exec)
+}
+
 func makeWhere(filters map[string]any) bson.D {
 	filter := bson.D{}
 
@@ -218,12 +248,6 @@ func (q *Query) Limit(n int64) QueryI {
 // One query a record that meets the filter conditions
 // If the search fails, an error will be returned
 func (q *Query) One(result interface{}) error {
-	if len(q.opts) > 0 {
-		if err := middleware.Do(q.ctx, q.opts[0].QueryHook, operator.BeforeQuery); err != nil {
-			return err
-		}
-	}
-
 	opt := options.FindOne()
 
 	if q.sort != nil {
@@ -242,19 +266,22 @@ func (q *Query) One(result interface{}) error {
 		opt.SetHint(q.hint)
 	}
 
-	err := q.collection.FindOne(q.ctx, q.filter, opt).Decode(result)
-
-	if err != nil {
-		return err
+	op := &middleware.Operation{
+		Type:    operator.OpQuery,
+		Filter:  q.filter,
+		Hook:    q.queryHook(),
+		Options: opt,
 	}
 
-	if len(q.opts) > 0 {
-		if err := middleware.Do(q.ctx, q.opts[0].QueryHook, operator.AfterQuery); err != nil {
+	return q.do(q.ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		if err := q.collection.FindOne(ctx, op.Filter, opt).Decode(result); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		op.Result = result
+
+		return nil
+	})
 }
 
 // All query multiple records that meet the filter conditions
@@ -266,12 +293,6 @@ func (q *Query) All(ctx context.Context, result_ ...interface{}) (result interfa
 		result = q.document
 	}
 
-	if len(q.opts) > 0 {
-		if err = middleware.Do(ctx, q.opts[0].QueryHook, operator.BeforeQuery); err != nil {
-			return
-		}
-	}
-
 	opts := options.Find()
 
 	if q.sort != nil {
@@ -298,27 +319,30 @@ func (q *Query) All(ctx context.Context, result_ ...interface{}) (result interfa
 		opts.SetBatchSize(int32(*q.batchSize))
 	}
 
-	var cursor *mongo.Cursor
-
-	cursor, err = q.collection.Find(ctx, q.filter, opts)
-
-	c := Cursor{
-		ctx:    ctx,
-		cursor: cursor,
-		err:    err,
+	op := &middleware.Operation{
+		Type:    operator.OpQuery,
+		Filter:  q.filter,
+		Hook:    q.queryHook(),
+		Options: opts,
 	}
 
-	err = c.All(result)
+	err = q.do(ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		cursor, err := q.collection.Find(ctx, op.Filter, opts)
 
-	if err != nil {
-		return
-	}
+		c := Cursor{
+			ctx:    ctx,
+			cursor: cursor,
+			err:    err,
+		}
 
-	if len(q.opts) > 0 {
-		if err = middleware.Do(ctx, q.opts[0].QueryHook, operator.AfterQuery); err != nil {
-			return
+		if err := c.All(result); err != nil {
+			return err
 		}
-	}
+
+		op.Result = result
+
+		return nil
+	})
 
 	return
 }
@@ -335,7 +359,26 @@ func (q *Query) Count() (n int64, err error) {
 		opt.SetSkip(*q.skip)
 	}
 
-	return q.collection.CountDocuments(q.ctx, q.filter, opt)
+	op := &middleware.Operation{
+		Type:    operator.OpCount,
+		Filter:  q.filter,
+		Options: opt,
+	}
+
+	err = q.do(q.ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		count, err := q.collection.CountDocuments(ctx, op.Filter, opt)
+
+		if err != nil {
+			return err
+		}
+
+		n = count
+		op.Result = count
+
+		return nil
+	})
+
+	return
 }
 
 // Distinct gets the unique value of the specified field in the collection and return it in the form of slice
@@ -357,37 +400,42 @@ func (q *Query) Distinct(key string, result interface{}) error {
 
 	opt := options.Distinct()
 
-	res, err := q.collection.Distinct(q.ctx, key, q.filter, opt)
-
-	if err != nil {
-		return err
+	op := &middleware.Operation{
+		Type:    operator.OpDistinct,
+		Filter:  q.filter,
+		Key:     key,
+		Options: opt,
 	}
 
-	registry := q.registry
+	return q.do(q.ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		res, err := q.collection.Distinct(ctx, op.Key, op.Filter, opt)
 
-	if registry == nil {
-		registry = bson.DefaultRegistry
-	}
+		if err != nil {
+			return err
+		}
 
-	valueType, valueBytes, err_ := bson.MarshalValueWithRegistry(registry, res)
+		registry := q.registry
 
-	if err_ != nil {
-		fmt.Printf("bson.MarshalValue err: %+v\n", err_)
+		if registry == nil {
+			registry = bson.DefaultRegistry
+		}
 
-		return err_
-	}
+		valueType, valueBytes, err := bson.MarshalValueWithRegistry(registry, res)
 
-	rawValue := bson.RawValue{Type: valueType, Value: valueBytes}
+		if err != nil {
+			return err
+		}
 
-	err = rawValue.Unmarshal(result)
+		rawValue := bson.RawValue{Type: valueType, Value: valueBytes}
 
-	if err != nil {
-		fmt.Printf("rawValue.Unmarshal err: %+v\n", err)
+		if err = rawValue.Unmarshal(result); err != nil {
+			return fmt.Errorf("%w: %v", ErrQueryResultTypeInconsistent, err)
+		}
 
-		return ErrQueryResultTypeInconsistent
-	}
+		op.Result = result
 
-	return nil
+		return nil
+	})
 }
 
 // Cursor gets a Cursor object, which can be used to traverse the query result set
@@ -415,16 +463,39 @@ func (q *Query) Cursor() CursorI {
 		opt.SetBatchSize(int32(*q.batchSize))
 	}
 
-	var err error
-	var cur *mongo.Cursor
+	op := &middleware.Operation{
+		Type:    operator.OpCursor,
+		Filter:  q.filter,
+		Hook:    q.queryHook(),
+		Options: opt,
+	}
+
+	var cursor *Cursor
+
+	err := q.do(q.ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		cur, err := q.collection.Find(ctx, op.Filter, opt)
 
-	cur, err = q.collection.Find(q.ctx, q.filter, opt)
+		cursor = &Cursor{
+			ctx:    ctx,
+			cursor: cur,
+			err:    err,
+		}
+
+		op.Result = cursor
+
+		return err
+	})
+
+	if err != nil {
+		// a middleware failed after the cursor was opened
+		if cursor != nil && cursor.err == nil {
+			cursor.cursor.Close(context.Background())
+		}
 
-	return &Cursor{
-		ctx:    q.ctx,
-		cursor: cur,
-		err:    err,
+		return &Cursor{ctx: q.ctx, err: err}
 	}
+
+	return cursor
 }
 
 // Apply runs the findAndModify command, which allows updating, replacing
@@ -443,22 +514,18 @@ func (q *Query) Cursor() CursorI {
 // and returns the document as it appeared before deletion; if no objects are found,
 // it will returns ErrNoDocuments.
 // When both Change.Replace and Change.Remove are false，it means update at most one document
-// in the collection and the update parameter must be a document containing update operators;
+// in the collection and the update parameter must be a document containing update operators or an UpdateBuilder;
 // if no objects are found and Change.Upsert is false, it will returns ErrNoDocuments.
 //
 // reference: https://docs.mongodb.com/manual/reference/command/findAndModify/
 func (q *Query) Apply(change Change, result interface{}) error {
-	var err error
-
 	if change.Remove {
-		err = q.findOneAndDelete(change, result)
+		return q.findOneAndDelete(change, result)
 	} else if change.Replace {
-		err = q.findOneAndReplace(change, result)
-	} else {
-		err = q.findOneAndUpdate(change, result)
+		return q.findOneAndReplace(change, result)
 	}
 
-	return err
+	return q.findOneAndUpdate(change, result)
 }
 
 // findOneAndDelete
@@ -474,7 +541,21 @@ func (q *Query) findOneAndDelete(change Change, result interface{}) error {
 		opts.SetProjection(q.project)
 	}
 
-	return q.collection.FindOneAndDelete(q.ctx, q.filter, opts).Decode(result)
+	op := &middleware.Operation{
+		Type:    operator.OpApply,
+		Filter:  q.filter,
+		Options: opts,
+	}
+
+	return q.do(q.ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		if err := q.collection.FindOneAndDelete(ctx, op.Filter, opts).Decode(result); err != nil {
+			return err
+		}
+
+		op.Result = result
+
+		return nil
+	})
 }
 
 // findOneAndReplace
@@ -498,13 +579,26 @@ func (q *Query) findOneAndReplace(change Change, result interface{}) error {
 		opts.SetReturnDocument(options.After)
 	}
 
-	err := q.collection.FindOneAndReplace(q.ctx, q.filter, change.Update, opts).Decode(result)
-
-	if change.Upsert && !change.ReturnNew && err == mongo.ErrNoDocuments {
-		return nil
+	op := &middleware.Operation{
+		Type:      operator.OpApply,
+		Filter:    q.filter,
+		Documents: change.Update,
+		Options:   opts,
 	}
 
-	return err
+	return q.do(q.ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		err := q.collection.FindOneAndReplace(ctx, op.Filter, op.Documents, opts).Decode(result)
+
+		if change.Upsert && !change.ReturnNew && err == mongo.ErrNoDocuments {
+			return nil
+		}
+
+		if err == nil {
+			op.Result = result
+		}
+
+		return err
+	})
 }
 
 // findOneAndUpdate
@@ -528,11 +622,46 @@ func (q *Query) findOneAndUpdate(change Change, result interface{}) error {
 		opts.SetReturnDocument(options.After)
 	}
 
-	err := q.collection.FindOneAndUpdate(q.ctx, q.filter, change.Update, opts).Decode(result)
+	update, arrayFilters, err := updateOf(change.Update)
 
-	if change.Upsert && !change.ReturnNew && err == mongo.ErrNoDocuments {
-		return nil
+	if err != nil {
+		return err
+	}
+
+	if arrayFilters != nil {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: arrayFilters})
+	}
+
+	// the registered model, else the document of the Model the query comes from, else a struct result
+	model := q.model
+
+	if model == nil {
+		model = q.document
+	}
+
+	if rv := reflect.ValueOf(result); model == nil && rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct {
+		model = result
+	}
+
+	op := &middleware.Operation{
+		Type:    operator.OpApply,
+		Filter:  q.filter,
+		Update:  update,
+		Model:   model,
+		Options: opts,
 	}
 
-	return err
+	return q.do(q.ctx, op, func(ctx context.Context, op *middleware.Operation) error {
+		err := q.collection.FindOneAndUpdate(ctx, op.Filter, op.Update, opts).Decode(result)
+
+		if change.Upsert && !change.ReturnNew && err == mongo.ErrNoDocuments {
+			return nil
+		}
+
+		if err == nil {
+			op.Result = result
+		}
+
+		return err
+	})
 }
@@ -24,3 +24,11 @@ type UpdateResult struct {
 type DeleteResult struct {
 	DeletedCount int64 // The number of documents deleted.
 }
+
+// SyncResult is the result type returned by a SyncDocuments operation.
+type SyncResult struct {
+	InsertedCount  int64 // The number of documents inserted.
+	UpdatedCount   int64 // The number of documents replaced because their content changed.
+	UnchangedCount int64 // The number of documents left as they are.
+	DeletedCount   int64 // The number of documents deleted because their key is not in the dataset.
+}
@@ -0,0 +1,44 @@
+package godm
+
+import (
+	"context"
+
+	"github.com/md-salehzadeh/godm/operator"
+	gOpts "github.com/md-salehzadeh/godm/options"
+	"github.com/md-salehzadeh/godm/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// InferSchema samples sampleSize documents of the collection with $sample and merges their types per path
+// Use GoSource of the result to emit struct definitions ready for RegisterModel, and Report or WriteReport
+// to inspect the field frequency and the type conflicts of the sample
+// Reference: https://docs.mongodb.com/manual/reference/operator/aggregation/sample/
+func (c *Collection) InferSchema(ctx context.Context, sampleSize int64, opts ...gOpts.AggregateOptions) (*schema.Schema, error) {
+	pipeline := Pipeline{
+		bson.D{{Key: operator.Sample, Value: bson.D{{Key: "size", Value: sampleSize}}}},
+	}
+
+	cursor := c.Aggregate(ctx, pipeline, opts...).Iter()
+
+	defer cursor.Close()
+
+	s := schema.New()
+
+	for {
+		var doc bson.Raw
+
+		if !cursor.Next(&doc) {
+			break
+		}
+
+		if err := s.Add(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,342 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// GenerateOptions controls the Go source emitted by GoSource
+type GenerateOptions struct {
+	// Package is the package clause of the generated file, "models" if empty
+	Package string
+	// TypeName is the name of the top level struct, "Document" if empty
+	TypeName string
+	// DefaultField embeds field.DefaultField instead of _id, createAt and updateAt when their types match it
+	DefaultField bool
+}
+
+// primitiveTypes maps BSON types to the Go types the driver decodes them into
+var primitiveTypes = map[bsontype.Type]string{
+	bsontype.Double:        "float64",
+	bsontype.String:        "string",
+	bsontype.Binary:        "[]byte",
+	bsontype.ObjectID:      "primitive.ObjectID",
+	bsontype.Boolean:       "bool",
+	bsontype.DateTime:      "time.Time",
+	bsontype.Regex:         "primitive.Regex",
+	bsontype.DBPointer:     "primitive.DBPointer",
+	bsontype.JavaScript:    "primitive.JavaScript",
+	bsontype.Symbol:        "primitive.Symbol",
+	bsontype.CodeWithScope: "primitive.CodeWithScope",
+	bsontype.Int32:         "int32",
+	bsontype.Timestamp:     "primitive.Timestamp",
+	bsontype.Int64:         "int64",
+	bsontype.Decimal128:    "primitive.Decimal128",
+	bsontype.MinKey:        "primitive.MinKey",
+	bsontype.MaxKey:        "primitive.MaxKey",
+}
+
+// generator collects the struct definitions of one GoSource call
+type generator struct {
+	opts    GenerateOptions
+	structs []*structDef
+	names   map[string]bool
+	imports map[string]bool
+}
+
+// structDef is one generated struct
+type structDef struct {
+	name    string
+	comment string
+	lines   []string
+}
+
+// GoSource emits Go struct definitions with bson tags for the sampled documents
+// Embedded documents become their own named structs, fields missing from some documents get omitempty
+// and scalar fields which have been null become pointers.
+// Conflicting types are widened when all of them are numeric, otherwise the field becomes interface{}
+// The result is gofmt-ed and ready to be registered with Connection.RegisterModel
+func (s *Schema) GoSource(opts GenerateOptions) ([]byte, error) {
+	if opts.Package == "" {
+		opts.Package = "models"
+	}
+
+	if opts.TypeName == "" {
+		opts.TypeName = "Document"
+	}
+
+	g := &generator{
+		opts:    opts,
+		names:   make(map[string]bool),
+		imports: make(map[string]bool),
+	}
+
+	g.structType(opts.TypeName, s.root, fmt.Sprintf("%s was inferred from %d sampled documents", opts.TypeName, s.root.Count))
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "package %s\n\n", opts.Package)
+
+	if len(g.imports) > 0 {
+		var imports []string
+
+		for i := range g.imports {
+			imports = append(imports, i)
+		}
+
+		sort.Strings(imports)
+
+		b.WriteString("import (\n")
+
+		for _, i := range imports {
+			fmt.Fprintf(&b, "\t%q\n", i)
+		}
+
+		b.WriteString(")\n\n")
+	}
+
+	for _, def := range g.structs {
+		fmt.Fprintf(&b, "// %s\ntype %s struct {\n", def.comment, def.name)
+
+		for _, line := range def.lines {
+			fmt.Fprintf(&b, "\t%s\n", line)
+		}
+
+		b.WriteString("}\n\n")
+	}
+
+	return format.Source(b.Bytes())
+}
+
+// structType generates the struct of an embedded document node and returns its name
+func (g *generator) structType(name string, n *Node, comment string) string {
+	name = g.uniqueName(name)
+
+	def := &structDef{name: name, comment: comment}
+
+	if comment == "" {
+		def.comment = fmt.Sprintf("%s was inferred from the documents at %s", name, n.Path)
+	}
+
+	g.structs = append(g.structs, def)
+
+	used := make(map[string]bool)
+	skip := make(map[string]bool)
+
+	if n.Path == "" && g.opts.DefaultField && matchDefaultField(n) {
+		g.imports["github.com/md-salehzadeh/godm/field"] = true
+
+		def.lines = append(def.lines, "field.DefaultField `bson:\",inline\"`", "")
+
+		skip["_id"], skip["createAt"], skip["updateAt"] = true, true, true
+		used["Id"], used["CreateAt"], used["UpdateAt"], used["DefaultField"] = true, true, true, true
+	}
+
+	for _, f := range n.Fields {
+		if skip[f.Key] {
+			continue
+		}
+
+		if strings.ContainsAny(f.Key, "\",`") {
+			def.lines = append(def.lines, fmt.Sprintf("// key %q can not be expressed in a bson tag", f.Key))
+
+			continue
+		}
+
+		fieldName := goName(f.Key)
+
+		for i := 2; used[fieldName]; i++ {
+			fieldName = fmt.Sprintf("%s%d", goName(f.Key), i)
+		}
+
+		used[fieldName] = true
+
+		tag := f.Key
+
+		if f.Optional(n) {
+			tag += ",omitempty"
+		}
+
+		line := fmt.Sprintf("%s %s `bson:%q`", fieldName, g.goType(name+fieldName, f), tag)
+
+		if f.Conflict() {
+			line += " // " + typesSummary(f)
+		}
+
+		def.lines = append(def.lines, line)
+	}
+
+	return name
+}
+
+// goType resolves the Go type of a node
+func (g *generator) goType(name string, n *Node) string {
+	types := n.ValueTypes()
+
+	var typ string
+
+	switch {
+	case len(types) == 0:
+		return "interface{}"
+	case len(types) == 1:
+		typ = g.singleType(name, n, types[0])
+	case numeric(types):
+		typ = "int64"
+
+		for _, t := range types {
+			if t == bsontype.Double {
+				typ = "float64"
+			}
+		}
+	default:
+		return "interface{}"
+	}
+
+	if n.Nullable() && !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") && typ != "interface{}" {
+		typ = "*" + typ
+	}
+
+	return typ
+}
+
+// singleType resolves the Go type of a node that has been seen with one BSON type only
+func (g *generator) singleType(name string, n *Node, t bsontype.Type) string {
+	switch t {
+	case bsontype.EmbeddedDocument:
+		if len(n.Fields) == 0 {
+			return "map[string]interface{}"
+		}
+
+		return g.structType(name, n, "")
+	case bsontype.Array:
+		if n.Elem == nil {
+			return "[]interface{}"
+		}
+
+		return "[]" + g.goType(name, n.Elem)
+	}
+
+	typ, ok := primitiveTypes[t]
+
+	if !ok {
+		return "interface{}"
+	}
+
+	if strings.HasPrefix(typ, "primitive.") {
+		g.imports["go.mongodb.org/mongo-driver/bson/primitive"] = true
+	} else if strings.HasPrefix(typ, "time.") {
+		g.imports["time"] = true
+	}
+
+	return typ
+}
+
+// uniqueName returns name, or name with a numeric suffix if a struct of that name exists already
+func (g *generator) uniqueName(name string) string {
+	unique := name
+
+	for i := 2; g.names[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+
+	g.names[unique] = true
+
+	return unique
+}
+
+// matchDefaultField checks if _id, createAt and updateAt of the root have the types of field.DefaultField
+func matchDefaultField(root *Node) bool {
+	want := map[string]bsontype.Type{
+		"_id":      bsontype.ObjectID,
+		"createAt": bsontype.DateTime,
+		"updateAt": bsontype.DateTime,
+	}
+
+	for _, f := range root.Fields {
+		t, ok := want[f.Key]
+
+		if !ok {
+			continue
+		}
+
+		if types := f.ValueTypes(); len(types) != 1 || types[0] != t || f.Nullable() {
+			return false
+		}
+
+		delete(want, f.Key)
+	}
+
+	return len(want) == 0
+}
+
+// numeric checks if all types are numbers the driver can decode into a wider Go number
+func numeric(types []bsontype.Type) bool {
+	for _, t := range types {
+		if t != bsontype.Int32 && t != bsontype.Int64 && t != bsontype.Double {
+			return false
+		}
+	}
+
+	return true
+}
+
+// goName converts a bson key to an exported Go identifier, like "_id" to "Id" and "first_name" to "FirstName"
+func goName(key string) string {
+	var b strings.Builder
+
+	upper := true
+
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	name := b.String()
+
+	if name == "" {
+		return "Field"
+	}
+
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "F" + name
+	}
+
+	return name
+}
+
+// typesSummary lists the types seen on a node with their counts, like "string(3), 32-bit integer(2)"
+func typesSummary(n *Node) string {
+	var types []bsontype.Type
+
+	for t := range n.Types {
+		types = append(types, t)
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+
+	parts := make([]string, 0, len(types))
+
+	for _, t := range types {
+		parts = append(parts, fmt.Sprintf("%s(%d)", t, n.Types[t]))
+	}
+
+	return strings.Join(parts, ", ")
+}
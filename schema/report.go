@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// FieldReport describes how often a path occurs in the sample and which types it had
+type FieldReport struct {
+	Path      string           // dotted path, array elements are suffixed with "[]"
+	Count     int64            // number of times the path has been seen
+	Frequency float64          // share of the parent documents containing the path, average length of arrays for "[]" paths
+	Types     map[string]int64 // number of times each BSON type, by name, has been seen on the path
+	Optional  bool             // the path is missing from some of its parent documents
+	Conflict  bool             // values of different types have been seen on the path
+}
+
+// Report returns the frequency and the types of every path, parents before their fields
+func (s *Schema) Report() []FieldReport {
+	var reports []FieldReport
+
+	var walk func(parent *Node, n *Node)
+
+	walk = func(parent *Node, n *Node) {
+		r := FieldReport{
+			Path:     n.Path,
+			Count:    n.Count,
+			Types:    make(map[string]int64, len(n.Types)),
+			Conflict: n.Conflict(),
+		}
+
+		// array elements are counted against the number of arrays they were seen in
+		total := parent.Documents()
+
+		if parent.Elem == n {
+			total = parent.Types[bsontype.Array]
+		} else {
+			r.Optional = n.Optional(parent)
+		}
+
+		if total > 0 {
+			r.Frequency = float64(n.Count) / float64(total)
+		}
+
+		for t, c := range n.Types {
+			r.Types[t.String()] = c
+		}
+
+		reports = append(reports, r)
+
+		for _, f := range n.Fields {
+			walk(n, f)
+		}
+
+		if n.Elem != nil {
+			walk(n, n.Elem)
+		}
+	}
+
+	for _, f := range s.root.Fields {
+		walk(s.root, f)
+	}
+
+	return reports
+}
+
+// Conflicts returns the report of the paths on which values of different types have been seen
+func (s *Schema) Conflicts() []FieldReport {
+	var conflicts []FieldReport
+
+	for _, r := range s.Report() {
+		if r.Conflict {
+			conflicts = append(conflicts, r)
+		}
+	}
+
+	return conflicts
+}
+
+// WriteReport writes the field frequency and type conflict report as a table
+func (s *Schema) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "sampled documents: %d\n\n", s.root.Count)
+	fmt.Fprintln(tw, "PATH\tCOUNT\tFREQUENCY\tTYPES\tCONFLICT")
+
+	for _, r := range s.Report() {
+		conflict := ""
+
+		if r.Conflict {
+			conflict = "yes"
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\t%s\t%s\n", r.Path, r.Count, r.Frequency*100, r.typesSummary(), conflict)
+	}
+
+	return tw.Flush()
+}
+
+// typesSummary lists the types of the report with their counts, ordered by name
+func (r FieldReport) typesSummary() string {
+	names := make([]string, 0, len(r.Types))
+
+	for name := range r.Types {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s(%d)", name, r.Types[name]))
+	}
+
+	return strings.Join(parts, ", ")
+}
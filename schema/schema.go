@@ -0,0 +1,173 @@
+package schema
+
+import (
+	"errors"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// ErrMalformedDocument return if a sampled value can not be read as the type it declares
+var ErrMalformedDocument = errors.New("malformed document in sample")
+
+// Schema accumulates the BSON types observed on every path of a set of sampled documents
+// Feed documents with Add, then use GoSource to emit struct definitions and Report to inspect the sample
+type Schema struct {
+	root *Node
+}
+
+// Node is one path of the sampled documents
+// Embedded documents keep their fields in Fields, arrays keep their elements in Elem
+type Node struct {
+	Key    string                  // key of the field in its parent, empty for the root and array elements
+	Path   string                  // dotted path of the field, array elements are suffixed with "[]"
+	Count  int64                   // number of times the path has been seen
+	Types  map[bsontype.Type]int64 // number of times each BSON type has been seen on the path
+	Fields []*Node                 // fields of embedded documents, in the order they were first seen
+	Elem   *Node                   // elements of arrays, nil if only empty arrays have been seen
+
+	fields map[string]*Node
+}
+
+// New creates an empty Schema
+func New() *Schema {
+	return &Schema{root: newNode("", "")}
+}
+
+// Add merges the types of one document into the schema
+func (s *Schema) Add(doc bson.Raw) error {
+	return s.root.add(bson.RawValue{Type: bsontype.EmbeddedDocument, Value: doc})
+}
+
+// Root returns the node of the top level documents
+func (s *Schema) Root() *Node {
+	return s.root
+}
+
+// Documents returns the number of documents added to the schema
+func (s *Schema) Documents() int64 {
+	return s.root.Count
+}
+
+// newNode creates the node of a path
+func newNode(key string, path string) *Node {
+	return &Node{
+		Key:    key,
+		Path:   path,
+		Types:  make(map[bsontype.Type]int64),
+		fields: make(map[string]*Node),
+	}
+}
+
+// add records one value seen on the path of n
+func (n *Node) add(value bson.RawValue) error {
+	n.Count++
+	n.Types[value.Type]++
+
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		doc, ok := value.DocumentOK()
+
+		if !ok {
+			return ErrMalformedDocument
+		}
+
+		elements, err := doc.Elements()
+
+		if err != nil {
+			return err
+		}
+
+		for _, element := range elements {
+			if err := n.field(element.Key()).add(element.Value()); err != nil {
+				return err
+			}
+		}
+	case bsontype.Array:
+		arr, ok := value.ArrayOK()
+
+		if !ok {
+			return ErrMalformedDocument
+		}
+
+		values, err := arr.Values()
+
+		if err != nil {
+			return err
+		}
+
+		for _, v := range values {
+			if n.Elem == nil {
+				n.Elem = newNode("", n.Path+"[]")
+			}
+
+			if err := n.Elem.add(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// field returns the child node of key, creating it on first sight
+func (n *Node) field(key string) *Node {
+	if f, ok := n.fields[key]; ok {
+		return f
+	}
+
+	path := key
+
+	if n.Path != "" {
+		path = n.Path + "." + key
+	}
+
+	f := newNode(key, path)
+
+	n.fields[key] = f
+	n.Fields = append(n.Fields, f)
+
+	return f
+}
+
+// Documents returns the number of embedded documents seen on the path
+// The fields of n are optional when they have been seen less often
+func (n *Node) Documents() int64 {
+	return n.Types[bsontype.EmbeddedDocument]
+}
+
+// Optional reports if the field is missing from some of the documents containing its parent
+func (n *Node) Optional(parent *Node) bool {
+	return n.Count < parent.Documents()
+}
+
+// Nullable reports if null or undefined has been seen on the path
+func (n *Node) Nullable() bool {
+	return n.Types[bsontype.Null] > 0 || n.Types[bsontype.Undefined] > 0
+}
+
+// ValueTypes returns the types seen on the path except null and undefined, ordered by type number
+func (n *Node) ValueTypes() []bsontype.Type {
+	var types []bsontype.Type
+
+	for t := range n.Types {
+		if t == bsontype.Null || t == bsontype.Undefined {
+			continue
+		}
+
+		types = append(types, t)
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+
+	return types
+}
+
+// Conflict reports if values of different types have been seen on the path
+// Mixed 32-bit and 64-bit integers and doubles are a conflict as well, they are widened when generating Go types
+func (n *Node) Conflict() bool {
+	return len(n.ValueTypes()) > 1
+}
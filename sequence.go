@@ -0,0 +1,24 @@
+package godm
+
+import (
+	"github.com/md-salehzadeh/godm/field"
+)
+
+// Sequence returns a generator of increasing int64 ids from the counter name of the counters collection
+// The blockSize is the number of ids reserved by one round trip to the database, outside of transactions, ids of a block
+// which are not used are skipped. Use one generator per counter in the process, for example as the id generator of a model:
+//
+//	var orderIds = cli.Sequence("orders", 100)
+//
+//	func (o *Order) IdGenerator() field.IdGenerator {
+//		return orderIds
+//	}
+func (c *Connection) Sequence(name string, blockSize int64) *field.SequenceGenerator {
+	coll := c.Config.Counters
+
+	if coll == "" {
+		coll = "counters"
+	}
+
+	return field.Sequence(c.Client.Database(c.Config.Database).Collection(coll), name, blockSize)
+}
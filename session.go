@@ -11,7 +11,8 @@ import (
 
 // Session is an struct that represents a MongoDB logical session
 type Session struct {
-	session mongo.Session
+	session    mongo.Session
+	connection *Connection
 }
 
 // StartTransaction starts transaction
@@ -26,6 +27,9 @@ type Session struct {
 //  the whole transaction will retry, so this transaction must be idempotent
 //- if operations in callback return godm.ErrTransactionNotSupported,
 //- If the ctx parameter already has a Session attached to it, it will be replaced by this session.
+//- after-hooks of operations in callback and callbacks registered with godm.OnCommit run once the transaction committed,
+//  callbacks registered with godm.OnRollback once it aborted; the first error of a commit callback is returned
+//  together with the result
 func (s *Session) StartTransaction(ctx context.Context, cb func(sessCtx context.Context) (interface{}, error), opts ...*opts.TransactionOptions) (interface{}, error) {
 	transactionOpts := options.Transaction()
 
@@ -33,12 +37,20 @@ func (s *Session) StartTransaction(ctx context.Context, cb func(sessCtx context.
 		transactionOpts = opts[0].TransactionOptions
 	}
 
-	result, err := s.session.WithTransaction(ctx, wrapperCustomCb(cb), transactionOpts)
+	queue := &txQueue{}
+
+	result, err := s.session.WithTransaction(ctx, wrapperCustomCb(cb, queue, s.connection), transactionOpts)
 
 	if err != nil {
+		queue.runRollback(ctx)
+
 		return nil, err
 	}
 
+	if err = queue.runCommit(ctx); err != nil {
+		return result, err
+	}
+
 	return result, nil
 }
 
@@ -54,9 +66,20 @@ func (s *Session) AbortTransaction(ctx context.Context) error {
 }
 
 // wrapperCustomF wrapper caller's callback function to mongo dirver's
-func wrapperCustomCb(cb func(ctx context.Context) (interface{}, error)) func(sessCtx mongo.SessionContext) (interface{}, error) {
+// Every try of the transaction starts with an empty queue of commit and rollback callbacks
+func wrapperCustomCb(cb func(ctx context.Context) (interface{}, error), queue *txQueue, connection *Connection) func(sessCtx mongo.SessionContext) (interface{}, error) {
 	return func(sessCtx mongo.SessionContext) (interface{}, error) {
-		result, err := cb(sessCtx)
+		queue.reset()
+
+		ctx := context.WithValue(sessCtx, txQueueKey{}, queue)
+
+		if connection != nil {
+			ctx = context.WithValue(ctx, txConnectionKey{}, connection)
+		}
+
+		ctx = mongo.NewSessionContext(ctx, sessCtx)
+
+		result, err := cb(ctx)
 
 		if err == ErrTransactionRetry {
 			return nil, mongo.CommandError{Labels: []string{driver.TransientTransactionError}}
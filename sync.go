@@ -0,0 +1,333 @@
+package godm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/md-salehzadeh/godm/field"
+	gOpts "github.com/md-salehzadeh/godm/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// syncDoc is a document of the dataset of SyncDocuments
+type syncDoc struct {
+	doc    interface{}
+	key    string
+	filter bson.D
+	hash   string
+}
+
+// SyncDocuments makes the documents of the collection match the slice docs, matching them by the keyFields
+// Documents with a new key are upserted, documents whose content changed are replaced and documents whose key is not
+// in docs are deleted, in one ordered Bulk running the deletes first. Stored documents without the key fields are left alone.
+// The content is compared by a hash of docs, stored in the HashField of the documents, so docs should be structs
+// or bson.D, whose fields have an order. It is taken before godm sets their fields, _id aside. Replaced documents keep
+// their id, creation time and creator. A unique index on keyFields is recommended.
+// ErrSyncKeyMissing or ErrSyncDuplicateKey is returned if the keys of docs are missing or not unique
+func (c *Collection) SyncDocuments(ctx context.Context, docs interface{}, keyFields []string, opts ...gOpts.SyncOptions) (*SyncResult, error) {
+	var o gOpts.SyncOptions
+
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.HashField == "" {
+		o.HashField = "syncHash"
+	}
+
+	if len(keyFields) == 0 {
+		return nil, fmt.Errorf("%w: no key fields", ErrSyncKeyMissing)
+	}
+
+	dataset, err := c.syncDataset(docs, keyFields, o.HashField)
+
+	if err != nil {
+		return nil, err
+	}
+
+	projection := bson.D{{Key: "_id", Value: 1}, {Key: o.HashField, Value: 1}}
+
+	for _, key := range keyFields {
+		projection = append(projection, bson.E{Key: key, Value: 1})
+	}
+
+	if len(dataset) > 0 {
+		for _, f := range field.InsertOnly(dataset[0].doc) {
+			if f.Key != "_id" {
+				projection = append(projection, bson.E{Key: f.Key, Value: 1})
+			}
+		}
+	}
+
+	cur, err := c.collection.Find(ctx, filterOf(o.Filter), options.Find().SetProjection(projection))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []bson.Raw
+
+	if err = cur.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bson.Raw, len(stored))
+
+	result := &SyncResult{}
+
+	b := c.Bulk().SetOrdered(true)
+
+	for _, doc := range stored {
+		key, _, err := syncKey(doc, keyFields)
+
+		if err != nil {
+			continue
+		}
+
+		if _, ok := existing[key]; ok {
+			result.DeletedCount++
+
+			b.RemoveId(doc.Lookup("_id"))
+
+			continue
+		}
+
+		existing[key] = doc
+	}
+
+	// the deletes run first, so none of them removes a document an upsert or a replace writes
+	keys := make(map[string]bool, len(dataset))
+
+	for _, d := range dataset {
+		keys[d.key] = true
+	}
+
+	for key, doc := range existing {
+		if keys[key] {
+			continue
+		}
+
+		result.DeletedCount++
+
+		b.RemoveId(doc.Lookup("_id"))
+	}
+
+	upsert := true
+
+	for _, d := range dataset {
+		doc, ok := existing[d.key]
+
+		filter := d.filter
+
+		switch {
+		case !ok:
+			result.InsertedCount++
+
+			if o.Filter != nil {
+				filter = bson.D{{Key: "$and", Value: bson.A{o.Filter, d.filter}}}
+			}
+
+			if o.DryRun {
+				continue
+			}
+
+			b.ReplaceOne(filter, d.doc, gOpts.BulkReplaceOptions{Upsert: &upsert})
+		case !sameHash(doc, o.HashField, d.hash):
+			result.UpdatedCount++
+
+			if o.DryRun {
+				continue
+			}
+
+			if err = c.keepInsertOnly(d.doc, doc); err != nil {
+				return nil, err
+			}
+
+			filter = bson.D{{Key: "_id", Value: doc.Lookup("_id")}}
+
+			b.ReplaceOne(filter, d.doc)
+		default:
+			result.UnchangedCount++
+
+			continue
+		}
+
+		set := bson.D{{Key: "$set", Value: bson.D{{Key: o.HashField, Value: d.hash}}}}
+
+		b.add(mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(set), nil)
+	}
+
+	if o.DryRun || len(b.queue) == 0 {
+		return result, nil
+	}
+
+	if _, err = b.Run(ctx); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// syncDataset returns the keys and the hashes of the documents of the slice docs
+func (c *Collection) syncDataset(docs interface{}, keyFields []string, hashField string) ([]syncDoc, error) {
+	v := reflect.Indirect(reflect.ValueOf(docs))
+
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, ErrNotValidSliceToInsert
+	}
+
+	dataset := make([]syncDoc, v.Len())
+
+	keys := make(map[string]int, v.Len())
+
+	for i := range dataset {
+		doc := v.Index(i)
+
+		if doc.Kind() == reflect.Struct && doc.CanAddr() {
+			doc = doc.Addr()
+		}
+
+		d := &dataset[i]
+
+		d.doc = doc.Interface()
+
+		var data []byte
+
+		var err error
+
+		if c.registry != nil {
+			data, err = bson.MarshalWithRegistry(c.registry, d.doc)
+		} else {
+			data, err = bson.Marshal(d.doc)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		key, values, err := syncKey(data, keyFields)
+
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+
+		if j, ok := keys[key]; ok {
+			return nil, fmt.Errorf("%w: documents %d and %d", ErrSyncDuplicateKey, j, i)
+		}
+
+		keys[key], d.key, d.filter, d.hash = i, key, values, syncHash(data, hashField)
+	}
+
+	return dataset, nil
+}
+
+// syncKey returns the key of the document doc, a string made of the values of keyFields, and its filter
+// Integral numbers make the same key whatever their type, like the ones the server compares as equal
+func syncKey(doc bson.Raw, keyFields []string) (string, bson.D, error) {
+	var key strings.Builder
+
+	filter := make(bson.D, 0, len(keyFields))
+
+	for _, path := range keyFields {
+		value, err := doc.LookupErr(strings.Split(path, ".")...)
+
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %s", ErrSyncKeyMissing, path)
+		}
+
+		key.WriteString(idKey(syncKeyValue(value)))
+
+		filter = append(filter, bson.E{Key: path, Value: value})
+	}
+
+	return key.String(), filter, nil
+}
+
+// syncKeyValue returns the value of a key field, integral int32 and double values as int64
+func syncKeyValue(value bson.RawValue) bson.RawValue {
+	var n int64
+
+	switch value.Type {
+	case bsontype.Int32:
+		n = int64(value.Int32())
+	case bsontype.Double:
+		f := value.Double()
+
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return value
+		}
+
+		n = int64(f)
+	default:
+		return value
+	}
+
+	t, data, _ := bson.MarshalValue(n)
+
+	return bson.RawValue{Type: t, Value: data}
+}
+
+// syncHash returns the content hash of the document doc, its _id and hashField left out
+func syncHash(doc bson.Raw, hashField string) string {
+	h := sha256.New()
+
+	elems, _ := doc.Elements()
+
+	for _, e := range elems {
+		if key := e.Key(); key != "_id" && key != hashField {
+			h.Write(e)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sameHash checks if the stored document doc has the content hash
+func sameHash(doc bson.Raw, hashField string, hash string) bool {
+	stored, ok := doc.Lookup(hashField).StringValueOK()
+
+	return ok && stored == hash
+}
+
+// keepInsertOnly sets the zero id, creation time and creator fields of doc to their values in the stored document
+func (c *Collection) keepInsertOnly(doc interface{}, stored bson.Raw) error {
+	v := reflect.ValueOf(doc)
+
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	for _, f := range field.InsertOnly(doc) {
+		fv, err := v.Elem().FieldByIndexErr(f.Index)
+
+		if err != nil || !fv.IsZero() {
+			continue
+		}
+
+		value, err := stored.LookupErr(f.Key)
+
+		if err != nil {
+			continue
+		}
+
+		if c.registry != nil {
+			err = value.UnmarshalWithRegistry(c.registry, fv.Addr().Interface())
+		} else {
+			err = value.Unmarshal(fv.Addr().Interface())
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Key, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package godm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/md-salehzadeh/godm/hook"
+	"github.com/md-salehzadeh/godm/middleware"
+)
+
+// txQueueKey is the context key of the txQueue of a transaction
+type txQueueKey struct{}
+
+// txConnectionKey is the context key of the Connection a transaction was started on
+type txConnectionKey struct{}
+
+// txQueue holds the callbacks to run once the transaction of a session context ended
+type txQueue struct {
+	mu       sync.Mutex
+	commit   []func(ctx context.Context) error
+	rollback []func(ctx context.Context) error
+}
+
+// OnCommit registers fn to run once the transaction of ctx committed
+// Outside of Connection.DoTransaction and Session.StartTransaction fn runs at once and its error is returned.
+// Callbacks registered by a try of the transaction that is retried are dropped, so fn runs exactly once
+// even if the transaction retries
+func OnCommit(ctx context.Context, fn func(ctx context.Context) error) error {
+	q := txQueueFrom(ctx)
+
+	if q == nil {
+		return fn(ctx)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.commit = append(q.commit, fn)
+
+	return nil
+}
+
+// OnRollback registers fn to run once the transaction of ctx aborted
+// Outside of Connection.DoTransaction and Session.StartTransaction fn is dropped
+func OnRollback(ctx context.Context, fn func(ctx context.Context) error) {
+	q := txQueueFrom(ctx)
+
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollback = append(q.rollback, fn)
+}
+
+// InTransaction reports if ctx is the context of a transaction started by godm
+func InTransaction(ctx context.Context) bool {
+	return txQueueFrom(ctx) != nil
+}
+
+// txQueueFrom returns the txQueue of ctx, nil if ctx is not in a transaction
+func txQueueFrom(ctx context.Context) *txQueue {
+	if ctx == nil {
+		return nil
+	}
+
+	q, _ := ctx.Value(txQueueKey{}).(*txQueue)
+
+	return q
+}
+
+// txConnectionFrom returns the Connection the transaction of ctx was started on, nil if ctx is not in a transaction
+func txConnectionFrom(ctx context.Context) *Connection {
+	if ctx == nil {
+		return nil
+	}
+
+	c, _ := ctx.Value(txConnectionKey{}).(*Connection)
+
+	return c
+}
+
+// reset drops the callbacks of a previous try of the transaction
+func (q *txQueue) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.commit = nil
+	q.rollback = nil
+}
+
+// runCommit runs the commit callbacks in order, it returns the first error
+func (q *txQueue) runCommit(ctx context.Context) error {
+	q.mu.Lock()
+	fns := q.commit
+	q.mu.Unlock()
+
+	return runCallbacks(ctx, fns)
+}
+
+// runRollback runs the rollback callbacks in order, it returns the first error
+func (q *txQueue) runRollback(ctx context.Context) error {
+	q.mu.Lock()
+	fns := q.rollback
+	q.mu.Unlock()
+
+	return runCallbacks(ctx, fns)
+}
+
+// runCallbacks runs every callback of fns, even when one of them failed
+func runCallbacks(ctx context.Context, fns []func(ctx context.Context) error) (err error) {
+	for _, fn := range fns {
+		if e := fn(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return
+}
+
+// handleHooks is the hook middleware of every connection
+// Inside a transaction the after-hooks are deferred until the transaction committed
+func handleHooks(ctx context.Context, op *middleware.Operation, next middleware.Handler) error {
+	if !InTransaction(ctx) {
+		return hook.Handle(ctx, op, next)
+	}
+
+	if err := hook.Before(ctx, op); err != nil {
+		return err
+	}
+
+	if err := next(ctx, op); err != nil {
+		return err
+	}
+
+	return afterHooks(ctx, op)
+}
+
+// afterHooks calls the after-hooks of op, or defers them until the transaction of ctx committed
+func afterHooks(ctx context.Context, op *middleware.Operation) error {
+	return OnCommit(ctx, func(ctx context.Context) error {
+		return hook.After(ctx, op)
+	})
+}
@@ -0,0 +1,273 @@
+package godm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/md-salehzadeh/godm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// UpdateBuilder builds an update document with operators, like
+// godm.Update().Set("name", "Lucas").Inc("age", 1).Push("tags", "new")
+// It is accepted as the update of Collection.UpdateOne, UpdateAll, Bulk.UpdateOne, UpdateAll and Query.Apply,
+// which also pass its array filters. A path changed twice, or a path and one of its parents, is reported as
+// ErrUpdatePathConflict by Err and by the operation
+type UpdateBuilder struct {
+	doc     bson.D
+	paths   map[string]string
+	filters []interface{}
+	err     error
+}
+
+// Update creates an empty UpdateBuilder
+func Update() *UpdateBuilder {
+	return &UpdateBuilder{paths: make(map[string]string)}
+}
+
+// ArrayModifier modifies the $each of UpdateBuilder.PushEach, see EachPosition, EachSort and EachSlice
+type ArrayModifier struct {
+	key   string
+	value interface{}
+}
+
+// EachPosition inserts the values at the index n of the array, counted from the end if n is negative
+func EachPosition(n int) ArrayModifier {
+	return ArrayModifier{key: operator.Position, value: n}
+}
+
+// EachSort sorts the array after the push, sort is 1, -1 or a document like bson.D{{Key: "score", Value: -1}}
+func EachSort(sort interface{}) ArrayModifier {
+	return ArrayModifier{key: operator.Sort, value: sort}
+}
+
+// EachSlice keeps the n first elements of the array after the push, the last ones if n is negative
+func EachSlice(n int) ArrayModifier {
+	return ArrayModifier{key: operator.Slice, value: n}
+}
+
+// Set sets path to value
+func (u *UpdateBuilder) Set(path string, value interface{}) *UpdateBuilder {
+	return u.add(operator.Set, path, value)
+}
+
+// SetOnInsert sets path to value if the update inserts a document
+func (u *UpdateBuilder) SetOnInsert(path string, value interface{}) *UpdateBuilder {
+	return u.add(operator.SetOnInsert, path, value)
+}
+
+// Inc increments path by n
+func (u *UpdateBuilder) Inc(path string, n interface{}) *UpdateBuilder {
+	return u.add(operator.Inc, path, n)
+}
+
+// Mul multiplies path by n
+func (u *UpdateBuilder) Mul(path string, n interface{}) *UpdateBuilder {
+	return u.add(operator.Mul, path, n)
+}
+
+// Min sets path to value if value is less than it
+func (u *UpdateBuilder) Min(path string, value interface{}) *UpdateBuilder {
+	return u.add(operator.Min, path, value)
+}
+
+// Max sets path to value if value is greater than it
+func (u *UpdateBuilder) Max(path string, value interface{}) *UpdateBuilder {
+	return u.add(operator.Max, path, value)
+}
+
+// Unset removes the paths
+func (u *UpdateBuilder) Unset(paths ...string) *UpdateBuilder {
+	for _, path := range paths {
+		u.add(operator.Unset, path, "")
+	}
+
+	return u
+}
+
+// Rename renames the field from to the field to
+func (u *UpdateBuilder) Rename(from string, to string) *UpdateBuilder {
+	if err := u.use(operator.Rename, to); err != nil {
+		return u
+	}
+
+	return u.add(operator.Rename, from, to)
+}
+
+// CurrentDate sets the paths to the current date of the server
+func (u *UpdateBuilder) CurrentDate(paths ...string) *UpdateBuilder {
+	for _, path := range paths {
+		u.add(operator.CurrentDate, path, true)
+	}
+
+	return u
+}
+
+// Push appends value to the array path
+func (u *UpdateBuilder) Push(path string, value interface{}) *UpdateBuilder {
+	return u.add(operator.Push, path, value)
+}
+
+// PushEach appends the elements of the slice values to the array path, with the modifiers
+func (u *UpdateBuilder) PushEach(path string, values interface{}, modifiers ...ArrayModifier) *UpdateBuilder {
+	each := bson.D{{Key: operator.Each, Value: toArray(values)}}
+
+	for _, m := range modifiers {
+		each = append(each, bson.E{Key: m.key, Value: m.value})
+	}
+
+	return u.add(operator.Push, path, each)
+}
+
+// AddToSet appends value to the array path unless the array holds it already
+func (u *UpdateBuilder) AddToSet(path string, value interface{}) *UpdateBuilder {
+	return u.add(operator.AddToSet, path, value)
+}
+
+// AddToSetEach appends the elements of the slice values the array path does not hold yet
+func (u *UpdateBuilder) AddToSetEach(path string, values interface{}) *UpdateBuilder {
+	return u.add(operator.AddToSet, path, bson.D{{Key: operator.Each, Value: toArray(values)}})
+}
+
+// Pull removes the elements of the array path equal to condition or matching it, like bson.M{"$gte": 6}
+func (u *UpdateBuilder) Pull(path string, condition interface{}) *UpdateBuilder {
+	return u.add(operator.Pull, path, condition)
+}
+
+// PullAll removes the elements of the array path equal to one of the elements of the slice values
+func (u *UpdateBuilder) PullAll(path string, values interface{}) *UpdateBuilder {
+	return u.add(operator.PullAll, path, toArray(values))
+}
+
+// PopFirst removes the first element of the array path
+func (u *UpdateBuilder) PopFirst(path string) *UpdateBuilder {
+	return u.add(operator.Pop, path, -1)
+}
+
+// PopLast removes the last element of the array path
+func (u *UpdateBuilder) PopLast(path string) *UpdateBuilder {
+	return u.add(operator.Pop, path, 1)
+}
+
+// ArrayFilters adds filters of the identifiers of filtered positional paths, like
+// Set("grades.$[g].passed", true).ArrayFilters(bson.M{"g.score": bson.M{"$gte": 50}})
+func (u *UpdateBuilder) ArrayFilters(filters ...interface{}) *UpdateBuilder {
+	u.filters = append(u.filters, filters...)
+
+	return u
+}
+
+// Err returns the first error of the builder, like ErrUpdatePathConflict
+func (u *UpdateBuilder) Err() error {
+	return u.err
+}
+
+// Document returns the update document, or the error of the builder
+// ErrUpdateEmpty is returned if no operator was added
+func (u *UpdateBuilder) Document() (bson.D, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+
+	if len(u.doc) == 0 {
+		return nil, ErrUpdateEmpty
+	}
+
+	return u.doc, nil
+}
+
+// Filters returns the array filters of the builder
+func (u *UpdateBuilder) Filters() []interface{} {
+	return u.filters
+}
+
+// MarshalBSON implements the bson.Marshaler interface, so the builder can be used as any update document
+func (u *UpdateBuilder) MarshalBSON() ([]byte, error) {
+	doc, err := u.Document()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.Marshal(doc)
+}
+
+// add sets path to value in the operator op
+func (u *UpdateBuilder) add(op string, path string, value interface{}) *UpdateBuilder {
+	if err := u.use(op, path); err != nil {
+		return u
+	}
+
+	for i, e := range u.doc {
+		if e.Key == op {
+			u.doc[i].Value = append(e.Value.(bson.D), bson.E{Key: path, Value: value})
+
+			return u
+		}
+	}
+
+	u.doc = append(u.doc, bson.E{Key: op, Value: bson.D{{Key: path, Value: value}}})
+
+	return u
+}
+
+// use records that op changes path, it fails if the builder failed or another operator changes path, one of its
+// parents or one of its children
+func (u *UpdateBuilder) use(op string, path string) error {
+	if u.err != nil {
+		return u.err
+	}
+
+	if path == "" {
+		u.err = fmt.Errorf("%w in %s", ErrUpdateEmptyPath, op)
+
+		return u.err
+	}
+
+	for p, o := range u.paths {
+		if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(path, p+".") {
+			u.err = fmt.Errorf("%w: %s in %s and %s in %s", ErrUpdatePathConflict, p, o, path, op)
+
+			return u.err
+		}
+	}
+
+	u.paths[path] = op
+
+	return nil
+}
+
+// toArray converts the slice values to a bson.A, other values become an array of one element
+func toArray(values interface{}) bson.A {
+	if a, ok := values.(bson.A); ok {
+		return a
+	}
+
+	v := reflect.ValueOf(values)
+
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return bson.A{values}
+	}
+
+	a := make(bson.A, v.Len())
+
+	for i := range a {
+		a[i] = v.Index(i).Interface()
+	}
+
+	return a
+}
+
+// updateOf returns the update document and the array filters of an UpdateBuilder, other updates as they are
+func updateOf(update interface{}) (interface{}, []interface{}, error) {
+	u, ok := update.(*UpdateBuilder)
+
+	if !ok {
+		return update, nil, nil
+	}
+
+	doc, err := u.Document()
+
+	return doc, u.filters, err
+}
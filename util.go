@@ -1,17 +1,26 @@
 package godm
 
 import (
+	"context"
 	"math"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/md-salehzadeh/godm/field"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Now return Millisecond current time
+// It follows the clock and the policy set by field.SetTimePolicy
 func Now() time.Time {
-	return time.Unix(0, time.Now().UnixNano()/1e6*1e6)
+	return field.Now()
+}
+
+// WithActor returns a copy of ctx carrying actor, the user or service which writes documents with it
+// Operations with the context record the actor in the field.AuditField of their documents
+func WithActor(ctx context.Context, actor interface{}) context.Context {
+	return field.WithActor(ctx, actor)
 }
 
 // NewObjectID generates a new ObjectID.
@@ -0,0 +1,526 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/md-salehzadeh/godm/field"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// define the validation tags which query the database
+//
+// godm_unique checks that no other document of the collection has the value of the field,
+// godm_unique=tenantId scopes the check to the documents with the same tenantId (several fields are separated by spaces).
+// The document itself is recognized by its _id, and the documents a replacement like Upsert replaces by the filter
+// of the operation. Two documents of one operation, like InsertMany, with the same value in the same scope fail.
+//
+// godm_exists=users._id checks that a document of the collection users has the value in its field _id.
+//
+// Zero values always pass, combine the tags with required if needed. godm_unique applies to top-level fields only,
+// and to the fields of update documents where it is unscoped. Both tags are skipped when the value is validated
+// without a database, for example by calling validate.Struct directly
+const (
+	UniqueTag = "godm_unique"
+	ExistsTag = "godm_exists"
+)
+
+// databaseKey is the context key of the database of the operation
+type databaseKey struct{}
+
+// stateKey is the context key of the state of the database-aware rules of one operation
+type stateKey struct{}
+
+// pathKey is the context key of the bson path of a value of an update document
+type pathKey struct{}
+
+// WithDatabase returns a copy of ctx in which the database-aware rules query db
+// Connections call it in their validator middleware with the database of the operation
+func WithDatabase(ctx context.Context, db *mongo.Database) context.Context {
+	return context.WithValue(ctx, databaseKey{}, db)
+}
+
+// state is shared by the database-aware rules of one operation
+type state struct {
+	db         *mongo.Database
+	collection string
+	filter     interface{}
+
+	mu      sync.Mutex
+	err     error
+	exists  map[string][]bson.RawValue // values found by the prefetch of godm_exists, by "collection.path"
+	uniques map[string][]bson.Raw      // documents found by the prefetch of godm_unique, by bson key
+	seen    map[string][]seenValue     // values of godm_unique in the documents of the operation, by bson key
+}
+
+// seenValue is a value of godm_unique in a document of the operation, with the values of its scope
+type seenValue struct {
+	value bson.RawValue
+	scope []bson.RawValue
+}
+
+// withState returns a copy of ctx holding a new state for an operation on collection, nil if ctx has no database
+// The filter of updates and replacements, like Upsert, is used to exclude the documents they change from godm_unique
+func withState(ctx context.Context, collection string, filter interface{}) (context.Context, *state) {
+	db, _ := ctx.Value(databaseKey{}).(*mongo.Database)
+
+	if db == nil {
+		return ctx, nil
+	}
+
+	s := &state{
+		db:         db,
+		collection: collection,
+		filter:     filter,
+		exists:     make(map[string][]bson.RawValue),
+		uniques:    make(map[string][]bson.Raw),
+		seen:       make(map[string][]seenValue),
+	}
+
+	return context.WithValue(ctx, stateKey{}, s), s
+}
+
+// stateFrom returns the state of ctx, nil if the operation has no database
+func stateFrom(ctx context.Context) *state {
+	s, _ := ctx.Value(stateKey{}).(*state)
+
+	return s
+}
+
+// fail records the first error of the database, the operation returns it instead of the validation errors
+func (s *state) fail(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+
+	return false
+}
+
+// registerRules registers the database-aware rules on v
+func registerRules(v *validator.Validate) {
+	_ = v.RegisterValidationCtx(UniqueTag, unique)
+	_ = v.RegisterValidationCtx(ExistsTag, exists)
+}
+
+// unique implements the godm_unique tag
+func unique(ctx context.Context, fl validator.FieldLevel) bool {
+	s := stateFrom(ctx)
+
+	if s == nil || fl.Field().IsZero() {
+		return true
+	}
+
+	value, err := rawValue(fl.Field().Interface())
+
+	if err != nil {
+		return s.fail(err)
+	}
+
+	scope := strings.Fields(fl.Param())
+
+	filter := bson.D{}
+
+	top := reflect.Indirect(fl.Top())
+
+	var key string
+
+	if fl.StructFieldName() != "" {
+		f, ok := topField(top, fl.StructFieldName(), fl.Parent())
+
+		if !ok {
+			return s.fail(fmt.Errorf("%s only applies to top-level fields, %s is nested", UniqueTag, fl.StructFieldName()))
+		}
+
+		key = f.Key
+	}
+
+	if prefix, ok := ctx.Value(pathKey{}).(string); ok {
+		// a value of an update document, the updated documents are excluded by the filter of the update
+		if len(scope) > 0 {
+			return true
+		}
+
+		if key != "" {
+			key = prefix + "." + key
+		} else {
+			key = prefix
+		}
+
+		if s.filter != nil {
+			filter = append(filter, bson.E{Key: "$nor", Value: bson.A{s.filter}})
+		}
+	} else {
+		scopeValues, err := topValues(top, scope)
+
+		if err != nil {
+			return s.fail(err)
+		}
+
+		id, err := topValues(top, []string{"_id"})
+
+		if err != nil {
+			return s.fail(err)
+		}
+
+		if !s.see(key, value, scopeValues) {
+			return false
+		}
+
+		if docs, ok := s.prefetched(key); ok {
+			return !conflicts(docs, key, value, scope, scopeValues, id[0])
+		}
+
+		for i, k := range scope {
+			filter = append(filter, bson.E{Key: k, Value: scopeValues[i]})
+		}
+
+		if id[0].Type != 0 {
+			filter = append(filter, bson.E{Key: "_id", Value: bson.M{"$ne": id[0]}})
+		}
+
+		// a replacement, the replaced documents are excluded by the filter of the operation
+		if s.filter != nil {
+			filter = append(filter, bson.E{Key: "$nor", Value: bson.A{s.filter}})
+		}
+	}
+
+	filter = append(filter, bson.E{Key: key, Value: value})
+
+	n, err := s.db.Collection(s.collection).CountDocuments(ctx, filter, options.Count().SetLimit(1))
+
+	if err != nil {
+		return s.fail(err)
+	}
+
+	return n == 0
+}
+
+// exists implements the godm_exists tag
+func exists(ctx context.Context, fl validator.FieldLevel) bool {
+	s := stateFrom(ctx)
+
+	if s == nil || fl.Field().IsZero() {
+		return true
+	}
+
+	coll, path, ok := splitRef(fl.Param())
+
+	if !ok {
+		return s.fail(fmt.Errorf("%s needs a parameter like users._id, got %q", ExistsTag, fl.Param()))
+	}
+
+	value, err := rawValue(fl.Field().Interface())
+
+	if err != nil {
+		return s.fail(err)
+	}
+
+	s.mu.Lock()
+	found := s.exists[fl.Param()]
+	s.mu.Unlock()
+
+	for _, v := range found {
+		if v.Equal(value) {
+			return true
+		}
+	}
+
+	n, err := s.db.Collection(coll).CountDocuments(ctx, bson.D{{Key: path, Value: value}}, options.Count().SetLimit(1))
+
+	if err != nil {
+		return s.fail(err)
+	}
+
+	return n > 0
+}
+
+// prefetch looks up the values of the godm_unique and godm_exists fields of every document of docs at once,
+// so validating the documents of InsertMany takes one query per field instead of one per document
+// tagName is the struct tag holding the rules
+func (s *state) prefetch(ctx context.Context, docs []reflect.Value, tagName string) error {
+	if len(docs) < 2 {
+		return nil
+	}
+
+	st := field.StructOf(docs[0].Type())
+
+	if st == nil {
+		return nil
+	}
+
+	for _, f := range st.Fields {
+		for _, rule := range strings.Split(f.Tag.Get(tagName), ",") {
+			name, param, _ := strings.Cut(rule, "=")
+
+			switch name {
+			case UniqueTag:
+				if err := s.prefetchUnique(ctx, docs, f, strings.Fields(param)); err != nil {
+					return err
+				}
+			case ExistsTag:
+				if err := s.prefetchExists(ctx, docs, f, param); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// prefetchUnique loads the documents of the collection which have one of the values of f in docs
+func (s *state) prefetchUnique(ctx context.Context, docs []reflect.Value, f *field.Field, scope []string) error {
+	values, err := fieldValues(docs, f)
+
+	if err != nil || len(values) == 0 {
+		return err
+	}
+
+	projection := bson.M{f.Key: 1, "_id": 1}
+
+	for _, k := range scope {
+		projection[k] = 1
+	}
+
+	filter := bson.D{{Key: f.Key, Value: bson.M{"$in": values}}}
+
+	// the documents replaced by the operation are no conflicts, see unique
+	if s.filter != nil {
+		filter = append(filter, bson.E{Key: "$nor", Value: bson.A{s.filter}})
+	}
+
+	cursor, err := s.db.Collection(s.collection).Find(ctx, filter, options.Find().SetProjection(projection))
+
+	if err != nil {
+		return err
+	}
+
+	var found []bson.Raw
+
+	if err = cursor.All(ctx, &found); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.uniques[f.Key] = found
+	s.mu.Unlock()
+
+	return nil
+}
+
+// prefetchExists loads the values of f in docs which exist in the referenced collection
+func (s *state) prefetchExists(ctx context.Context, docs []reflect.Value, f *field.Field, param string) error {
+	coll, path, ok := splitRef(param)
+
+	if !ok {
+		return nil
+	}
+
+	values, err := fieldValues(docs, f)
+
+	if err != nil || len(values) == 0 {
+		return err
+	}
+
+	cursor, err := s.db.Collection(coll).Find(ctx, bson.M{path: bson.M{"$in": values}}, options.Find().SetProjection(bson.M{path: 1}))
+
+	if err != nil {
+		return err
+	}
+
+	var found []bson.Raw
+
+	if err = cursor.All(ctx, &found); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, doc := range found {
+		if v, err := doc.LookupErr(strings.Split(path, ".")...); err == nil {
+			s.exists[param] = append(s.exists[param], v)
+		}
+	}
+
+	return nil
+}
+
+// prefetched returns the documents the prefetch of godm_unique loaded for key
+func (s *state) prefetched(key string) ([]bson.Raw, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs, ok := s.uniques[key]
+
+	return docs, ok
+}
+
+// see records value at key in the scope of a document of the operation
+// It reports false if another document of the operation has the value in the same scope, like two documents of
+// one InsertMany
+func (s *state) see(key string, value bson.RawValue, scopeValues []bson.RawValue) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, seen := range s.seen[key] {
+		if !seen.value.Equal(value) {
+			continue
+		}
+
+		same := true
+
+		for i, v := range seen.scope {
+			if !v.Equal(scopeValues[i]) {
+				same = false
+
+				break
+			}
+		}
+
+		if same {
+			return false
+		}
+	}
+
+	s.seen[key] = append(s.seen[key], seenValue{value: value, scope: scopeValues})
+
+	return true
+}
+
+// conflicts checks if one of docs is another document with value at key in the same scope
+func conflicts(docs []bson.Raw, key string, value bson.RawValue, scope []string, scopeValues []bson.RawValue, id bson.RawValue) bool {
+	for _, doc := range docs {
+		if !doc.Lookup(key).Equal(value) {
+			continue
+		}
+
+		if id.Type != 0 && doc.Lookup("_id").Equal(id) {
+			continue
+		}
+
+		same := true
+
+		for i, k := range scope {
+			if v := doc.Lookup(k); !v.Equal(scopeValues[i]) && !(v.Type == 0 && scopeValues[i].Type == bson.TypeNull) {
+				same = false
+
+				break
+			}
+		}
+
+		if same {
+			return true
+		}
+	}
+
+	return false
+}
+
+// topField returns the field of the document top named name, it reports false if the field is not
+// a top-level field of the document, the fields of inline structs are top-level
+func topField(top reflect.Value, name string, parent reflect.Value) (*field.Field, bool) {
+	st := field.StructOf(top.Type())
+
+	if st == nil {
+		return nil, false
+	}
+
+	for _, f := range st.Fields {
+		if f.Name != name {
+			continue
+		}
+
+		owner, err := top.FieldByIndexErr(f.Index[:len(f.Index)-1])
+
+		if err != nil {
+			return nil, false
+		}
+
+		return f, owner.Type() == reflect.Indirect(parent).Type()
+	}
+
+	return nil, false
+}
+
+// topValues returns the values of the fields with the bson keys of the document top
+// Values of missing fields are null, the value of a missing _id is empty
+func topValues(top reflect.Value, keys []string) ([]bson.RawValue, error) {
+	st := field.StructOf(top.Type())
+
+	values := make([]bson.RawValue, len(keys))
+
+	for i, key := range keys {
+		f, ok := st.Field(key)
+
+		if !ok {
+			if key != "_id" {
+				values[i] = bson.RawValue{Type: bson.TypeNull}
+			}
+
+			continue
+		}
+
+		v, err := top.FieldByIndexErr(f.Index)
+
+		if err != nil || key == "_id" && v.IsZero() {
+			continue
+		}
+
+		if values[i], err = rawValue(v.Interface()); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// fieldValues returns the non-zero values of f in docs
+func fieldValues(docs []reflect.Value, f *field.Field) (bson.A, error) {
+	var values bson.A
+
+	for _, doc := range docs {
+		v, err := doc.FieldByIndexErr(f.Index)
+
+		if err != nil || v.IsZero() {
+			continue
+		}
+
+		raw, err := rawValue(v.Interface())
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, raw)
+	}
+
+	return values, nil
+}
+
+// rawValue marshals v the way it is stored in documents
+func rawValue(v interface{}) (bson.RawValue, error) {
+	t, data, err := bson.MarshalValue(v)
+
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+
+	return bson.RawValue{Type: t, Value: data}, nil
+}
+
+// splitRef splits the parameter of godm_exists into the collection and the bson path
+func splitRef(param string) (string, string, bool) {
+	coll, path, ok := strings.Cut(param, ".")
+
+	return coll, path, ok && coll != "" && path != ""
+}
@@ -0,0 +1,170 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"github.com/md-salehzadeh/godm/field"
+)
+
+// ValidationError lists the values of a document or an update document which failed validation
+// It unwraps to the validator.ValidationErrors of go-playground/validator
+type ValidationError struct {
+	Failures []*Failure
+}
+
+// Failure is one value which failed validation
+type Failure struct {
+	Path     string      // bson path of the value, like "items.0.city"
+	Rule     string      // the failed rule, like "max", or "type" if the value does not decode into its field
+	Param    string      // parameter of the rule, like "5" for "max=5", or the Go type for "type"
+	Value    interface{} // the rejected value
+	Operator string      // update operator of the value, like "$set", empty for documents
+
+	err error // validator.FieldError, or the error of decoding the value
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+
+	for _, f := range e.Failures {
+		msgs = append(msgs, f.Error())
+	}
+
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the validator.ValidationErrors of the failures, nil if no failure comes from the validator
+func (e *ValidationError) Unwrap() error {
+	var errs validator.ValidationErrors
+
+	for _, f := range e.Failures {
+		if fe, ok := f.err.(validator.FieldError); ok {
+			errs = append(errs, fe)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// Translate returns the messages of the failures in the language of trans, keyed by bson path
+// Translations are registered on the validator, for example by the translations packages of go-playground/validator
+func (e *ValidationError) Translate(trans ut.Translator) map[string]string {
+	msgs := make(map[string]string, len(e.Failures))
+
+	for _, f := range e.Failures {
+		msgs[f.Path] = f.Translate(trans)
+	}
+
+	return msgs
+}
+
+// Error implements the error interface
+func (f *Failure) Error() string {
+	path := f.Path
+
+	if f.Operator != "" {
+		path = f.Operator + " " + path
+	}
+
+	if f.Rule == "type" {
+		return fmt.Sprintf("%s: %v", path, f.err)
+	}
+
+	if f.Param != "" {
+		return fmt.Sprintf("%s failed on the '%s=%s' rule", path, f.Rule, f.Param)
+	}
+
+	return fmt.Sprintf("%s failed on the '%s' rule", path, f.Rule)
+}
+
+// Unwrap returns the validator.FieldError of the failure, or the error of decoding the value
+func (f *Failure) Unwrap() error {
+	return f.err
+}
+
+// Translate returns the message of the failure in the language of trans
+// It falls back to the untranslated message of the validator if trans has no translation of the rule
+func (f *Failure) Translate(trans ut.Translator) string {
+	if fe, ok := f.err.(validator.FieldError); ok {
+		return fe.Translate(trans)
+	}
+
+	return f.Error()
+}
+
+// newValidationError converts the error of validating a value of type t at the bson path prefix,
+// strct tells if the value was validated by validate.Struct or by validate.Var
+// Errors which are not validator.ValidationErrors are returned as they are
+func newValidationError(err error, t reflect.Type, strct bool, prefix string, op string) error {
+	var errs validator.ValidationErrors
+
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	e := &ValidationError{}
+
+	for _, fe := range errs {
+		e.Failures = append(e.Failures, &Failure{
+			Path:     join(prefix, field.BsonPath(t, namespace(fe, strct))),
+			Rule:     fe.Tag(),
+			Param:    fe.Param(),
+			Value:    fe.Value(),
+			Operator: op,
+			err:      fe,
+		})
+	}
+
+	return e
+}
+
+// namespace returns the namespace of fe without the name of the validated struct
+func namespace(fe validator.FieldError, strct bool) string {
+	ns := fe.StructNamespace()
+
+	if !strct {
+		return ns
+	}
+
+	if i := strings.IndexByte(ns, '.'); i >= 0 {
+		return ns[i+1:]
+	}
+
+	return ""
+}
+
+// join joins two bson paths, either may be empty
+func join(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+
+	if path == "" {
+		return prefix
+	}
+
+	return prefix + "." + path
+}
+
+// merge appends the failures of err to e, errors which are not a *ValidationError are returned as they are
+func (e *ValidationError) merge(err error) error {
+	var ve *ValidationError
+
+	if !errors.As(err, &ve) {
+		return err
+	}
+
+	e.Failures = append(e.Failures, ve.Failures...)
+
+	return nil
+}
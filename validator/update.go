@@ -0,0 +1,230 @@
+package validator
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/md-salehzadeh/godm/field"
+	"github.com/md-salehzadeh/godm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// valueOperators are the update operators whose values are stored into the fields as they are
+var valueOperators = []string{operator.Set, operator.SetOnInsert, operator.Min, operator.Max}
+
+// deltaOperators are the update operators whose values are deltas or factors of the fields, not stored values
+var deltaOperators = []string{operator.Inc, operator.Mul}
+
+// elemOperators are the update operators whose values are stored as elements of array fields
+var elemOperators = []string{operator.Push, operator.AddToSet}
+
+// Update validates the values of the update operators $set, $setOnInsert, $min, $max, $push and $addToSet
+// against the validate tags of the fields of model the paths lead to
+// Values are decoded into the type of their field first, so a value of the wrong type fails too. The operands of
+// $inc and $mul are only decoded, the rules of the field apply to its value, not to a delta or a factor.
+// Elements pushed to an array are checked with the rules after "dive" in the tag of the array.
+// Paths which are not fields of model are skipped, as well as update pipelines.
+// Every failing value is listed in the returned *ValidationError
+func Update(ctx context.Context, model interface{}, update interface{}) error {
+	return std.Update(ctx, model, update)
+}
+
+// Update validates update against model, see the package function Update
+func (v *Validator) Update(ctx context.Context, model interface{}, update interface{}) error {
+	t := reflect.TypeOf(model)
+
+	if field.StructOf(t) == nil || update == nil {
+		return nil
+	}
+
+	raw, err := toRaw(update)
+
+	if err != nil || raw == nil {
+		return nil
+	}
+
+	e := &ValidationError{}
+
+	for _, op := range valueOperators {
+		if err := eachValue(raw, op, func(path string, value bson.RawValue) error {
+			return e.merge(v.checkValue(ctx, t, op, path, value, false, true))
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, op := range deltaOperators {
+		if err := eachValue(raw, op, func(path string, value bson.RawValue) error {
+			return e.merge(v.checkValue(ctx, t, op, path, value, false, false))
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, op := range elemOperators {
+		if err := eachValue(raw, op, func(path string, value bson.RawValue) error {
+			if doc, ok := value.DocumentOK(); ok {
+				if each, ok := doc.Lookup("$each").ArrayOK(); ok {
+					values, err := each.Values()
+
+					if err != nil {
+						return err
+					}
+
+					for _, elem := range values {
+						if err := e.merge(v.checkValue(ctx, t, op, path, elem, true, true)); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				}
+			}
+
+			return e.merge(v.checkValue(ctx, t, op, path, value, true, true))
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(e.Failures) > 0 {
+		return e
+	}
+
+	return nil
+}
+
+// toRaw marshals an update document, it returns nil if update is a pipeline
+func toRaw(update interface{}) (bson.Raw, error) {
+	switch v := update.(type) {
+	case bson.Raw:
+		return v, nil
+	case []byte:
+		return v, nil
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(update)).Kind() {
+	case reflect.Slice, reflect.Array:
+		if _, ok := update.(bson.D); !ok {
+			return nil, nil
+		}
+	}
+
+	b, err := bson.Marshal(update)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// eachValue calls fn for every path of the update operator op
+func eachValue(raw bson.Raw, op string, fn func(path string, value bson.RawValue) error) error {
+	doc, ok := raw.Lookup(op).DocumentOK()
+
+	if !ok {
+		return nil
+	}
+
+	elems, err := doc.Elements()
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range elems {
+		if err := fn(e.Key(), e.Value()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkValue decodes value into the type the path leads to and validates it
+// elem means value is an element of the array at path, rules means the validate tags apply to value
+func (v *Validator) checkValue(ctx context.Context, t reflect.Type, op, path string, value bson.RawValue, elem bool, rules bool) error {
+	r, err := field.Resolve(t, path)
+
+	if err != nil || r.Field == nil {
+		return nil
+	}
+
+	typ, dives := r.Type, r.Elem
+
+	if elem {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+
+		if typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array {
+			return nil
+		}
+
+		typ = typ.Elem()
+		dives++
+	}
+
+	if typ.Kind() == reflect.Interface {
+		return nil
+	}
+
+	ptr := reflect.New(typ)
+
+	if err := value.Unmarshal(ptr.Interface()); err != nil {
+		return &ValidationError{Failures: []*Failure{
+			{Path: path, Rule: "type", Param: typ.String(), Value: value, Operator: op, err: err},
+		}}
+	}
+
+	if !rules {
+		return nil
+	}
+
+	decoded := ptr.Elem().Interface()
+
+	ctx = context.WithValue(ctx, pathKey{}, path)
+
+	e := &ValidationError{}
+
+	if tag := diveTag(r.Field.Tag.Get(v.tagName), dives); tag != "" {
+		if err := e.merge(newValidationError(v.validate.VarCtx(ctx, decoded, tag), typ, false, path, op)); err != nil {
+			return err
+		}
+	}
+
+	if validatorStruct(decoded) {
+		if err := e.merge(newValidationError(v.validate.StructCtx(ctx, decoded), typ, true, path, op)); err != nil {
+			return err
+		}
+	}
+
+	if len(e.Failures) > 0 {
+		return e
+	}
+
+	return nil
+}
+
+// diveTag returns the rules of tag which apply to the values n levels of "dive" below the field
+func diveTag(tag string, n int) string {
+	rules := strings.Split(tag, ",")
+
+	for ; n > 0; n-- {
+		i := 0
+
+		for i < len(rules) && rules[i] != "dive" {
+			i++
+		}
+
+		if i == len(rules) {
+			return ""
+		}
+
+		rules = rules[i+1:]
+	}
+
+	return strings.Join(rules, ",")
+}
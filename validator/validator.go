@@ -6,29 +6,169 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/md-salehzadeh/godm/middleware"
 	"github.com/md-salehzadeh/godm/operator"
 )
 
-// use a single instance of Validate, it caches struct info
-var validate = validator.New()
+// Config configures a Validator
+type Config struct {
+	// TagName is the struct tag holding the rules, the default is "validate"
+	TagName string `json:"tagName"`
+	// Skip lists the operation types which are not validated, like operator.OpUpdate
+	Skip []operator.OpType `json:"skip"`
+	// Updates validates the update documents of updates and Apply against the model of the collection, see Update.
+	// The default is false.
+	Updates bool `json:"updates"`
+	// Rules are custom rules by tag
+	Rules map[string]validator.FuncCtx `json:"-"`
+	// StructRules are struct-level validations
+	StructRules []StructRule `json:"-"`
+	// Validate is used instead of a new instance if set, TagName, Rules and StructRules are registered on it
+	Validate *validator.Validate `json:"-"`
+}
+
+// StructRule is a struct-level validation of the types of Types
+type StructRule struct {
+	Fn    validator.StructLevelFuncCtx
+	Types []interface{}
+}
+
+// Validator validates the documents and update documents of operations
+// Every Connection has one, configured by Config.Validation
+type Validator struct {
+	validate *validator.Validate
+	tagName  string
+	skip     map[operator.OpType]bool
+	updates  bool
+}
+
+// New creates a Validator with the database-aware rules godm_unique and godm_exists
+func New(conf Config) (*Validator, error) {
+	v := &Validator{
+		validate: conf.Validate,
+		tagName:  conf.TagName,
+		skip:     make(map[operator.OpType]bool),
+		updates:  conf.Updates,
+	}
+
+	if v.validate == nil {
+		v.validate = validator.New()
+	}
+
+	if v.tagName != "" {
+		v.validate.SetTagName(v.tagName)
+	} else {
+		v.tagName = "validate"
+	}
+
+	registerRules(v.validate)
+
+	for tag, fn := range conf.Rules {
+		if err := v.validate.RegisterValidationCtx(tag, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rule := range conf.StructRules {
+		v.validate.RegisterStructValidationCtx(rule.Fn, rule.Types...)
+	}
+
+	for _, t := range conf.Skip {
+		v.skip[t] = true
+	}
+
+	return v, nil
+}
+
+// Validate returns the go-playground validator, to register translations for example
+func (v *Validator) Validate() *validator.Validate {
+	return v.validate
+}
+
+// std is the Validator of the package functions and of connections without Config.Validation
+var std, _ = New(Config{})
 
 // SetValidate let validate can use custom rules
+// The database-aware rules godm_unique and godm_exists are registered on v
+// Deprecated: it changes the validation of every Connection without Config.Validation in the process,
+// configure the validation of a Connection by Config.Validation instead
 func SetValidate(v *validator.Validate) {
-	validate = v
+	registerRules(v)
+
+	std = &Validator{validate: v, tagName: "validate", skip: make(map[operator.OpType]bool)}
+}
+
+// Default returns the Validator of the package functions
+func Default() *Validator {
+	return std
 }
 
 // validatorNeeded checks if the validator is needed to opType
 func validatorNeeded(opType operator.OpType) bool {
 	switch opType {
-	case operator.BeforeInsert, operator.BeforeUpsert, operator.BeforeReplace:
+	case operator.BeforeInsert, operator.BeforeUpsert, operator.BeforeReplace, operator.BeforeApply:
 		return true
 	}
 	return false
 }
 
-// Do calls validator check
+// Handle is the validator middleware of the default Validator
+func Handle(ctx context.Context, op *middleware.Operation, next middleware.Handler) error {
+	return std.Handle(ctx, op, next)
+}
+
+// Handle is the validator middleware of a connection
+// It validates the documents of the operation, and with Config.Updates the update document against the model of
+// the collection when the operation has one, see Update. Operations of the types in Config.Skip are not validated.
+// The database-aware rules query the database set by WithDatabase, an error of the database is returned as it is
+func (v *Validator) Handle(ctx context.Context, op *middleware.Operation, next middleware.Handler) error {
+	if v.skip[op.Type] {
+		return next(ctx, op)
+	}
+
+	vCtx, s := withState(ctx, op.Collection, op.Filter)
+
+	err := v.handle(vCtx, op)
+
+	if s != nil && s.err != nil {
+		return s.err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return next(ctx, op)
+}
+
+// handle validates the documents and the update document of op
+func (v *Validator) handle(ctx context.Context, op *middleware.Operation) error {
+	doc := op.Documents
+
+	if doc == nil {
+		doc = op.Hook
+	}
+
+	if err := v.Do(ctx, doc, op.Type.Before()); err != nil {
+		return err
+	}
+
+	if v.updates && op.Model != nil && op.Update != nil && (op.Type == operator.OpUpdate || op.Type == operator.OpApply) {
+		return v.Update(ctx, op.Model, op.Update)
+	}
+
+	return nil
+}
+
+// Do calls validator check of the default Validator
 // Don't use opts here
 func Do(ctx context.Context, doc interface{}, opType operator.OpType, opts ...interface{}) error {
+	return std.Do(ctx, doc, opType, opts...)
+}
+
+// Do calls validator check
+// Don't use opts here
+func (v *Validator) Do(ctx context.Context, doc interface{}, opType operator.OpType, opts ...interface{}) error {
 	if !validatorNeeded(opType) {
 		return nil
 	}
@@ -38,48 +178,80 @@ func Do(ctx context.Context, doc interface{}, opType operator.OpType, opts ...in
 	}
 	switch reflect.TypeOf(doc).Kind() {
 	case reflect.Slice:
-		return sliceHandle(doc, opType)
+		return v.sliceHandle(ctx, doc, opType)
 	case reflect.Ptr:
-		v := reflect.ValueOf(doc).Elem()
-		switch v.Kind() {
+		val := reflect.ValueOf(doc).Elem()
+		switch val.Kind() {
 		case reflect.Slice:
-			return sliceHandle(v.Interface(), opType)
+			return v.sliceHandle(ctx, val.Interface(), opType)
 		default:
-			return do(doc)
+			return v.do(ctx, doc)
 		}
 	default:
-		return do(doc)
+		return v.do(ctx, doc)
 	}
 }
 
 // sliceHandle handles the slice docs
-func sliceHandle(docs interface{}, opType operator.OpType) error {
+func (v *Validator) sliceHandle(ctx context.Context, docs interface{}, opType operator.OpType) error {
+	var values []reflect.Value
+
 	// []interface{}{UserType{}...}
 	if h, ok := docs.([]interface{}); ok {
-		for _, v := range h {
-			if err := do(v); err != nil {
-				return err
-			}
+		for _, doc := range h {
+			values = append(values, reflect.ValueOf(doc))
+		}
+	} else {
+		// []UserType{}
+		s := reflect.ValueOf(docs)
+		for i := 0; i < s.Len(); i++ {
+			values = append(values, s.Index(i))
 		}
-		return nil
 	}
-	// []UserType{}
-	s := reflect.ValueOf(docs)
-	for i := 0; i < s.Len(); i++ {
-		if err := do(s.Index(i).Interface()); err != nil {
 
+	if s := stateFrom(ctx); s != nil {
+		if err := s.prefetch(ctx, structs(values), v.tagName); err != nil {
+			return err
+		}
+	}
+
+	for _, val := range values {
+		if err := v.do(ctx, val.Interface()); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// do check if opType is supported and call fieldHandler
-func do(doc interface{}) error {
+// structs returns the struct values of docs when all of them have the same type, pointers are dereferenced
+func structs(docs []reflect.Value) []reflect.Value {
+	values := make([]reflect.Value, 0, len(docs))
+
+	for _, v := range docs {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil
+			}
+
+			v = v.Elem()
+		}
+
+		if v.Kind() != reflect.Struct || len(values) > 0 && v.Type() != values[0].Type() {
+			return nil
+		}
+
+		values = append(values, v)
+	}
+
+	return values
+}
+
+// do validates doc, failures are returned as a *ValidationError
+func (v *Validator) do(ctx context.Context, doc interface{}) error {
 	if !validatorStruct(doc) {
 		return nil
 	}
-	return validate.Struct(doc)
+	return newValidationError(v.validate.StructCtx(ctx, doc), reflect.TypeOf(doc), true, "", "")
 }
 
 // validatorStruct check if kind of doc is validator supported struct